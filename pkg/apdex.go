@@ -0,0 +1,69 @@
+package main
+
+import (
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+// defaultApdexThreshold is the Apdex T of services without ApdexThreshold
+const defaultApdexThreshold = 500 * time.Millisecond
+
+// apdexThresholds are the compiled Apdex T settings of a service, in seconds
+type apdexThresholds struct {
+	service   float64
+	endpoints map[string]float64
+}
+
+// apdexZone returns whether a request is satisfied (at most T) or tolerating
+// (at most 4T). Server errors are frustrated whatever their latency.
+func apdexZone(duration float64, status int, threshold float64) (satisfied, tolerating bool) {
+	if status >= 500 {
+		return false, false
+	}
+	if duration <= threshold {
+		return true, false
+	}
+	return false, duration <= 4*threshold
+}
+
+// Apdex is the Apdex score of the window, (satisfied + tolerating/2) / requests
+func (s windowSummary) Apdex() float64 {
+	return s.ratio(s.Satisfied) + s.ratio(s.Tolerating)/2
+}
+
+// compileApdexThreshold parses an Apdex T, falling back with a warning if it is invalid
+func compileApdexThreshold(setting, value string, fallback float64) float64 {
+	if value == "" {
+		return fallback
+	}
+	threshold, err := time.ParseDuration(value)
+	if err != nil || threshold <= 0 {
+		logger.Warnf("Invalid %s '%s' - it needs to be a positive duration and will be ignored", setting, value)
+		return fallback
+	}
+	return threshold.Seconds()
+}
+
+func (sc *ServiceConfig) compileApdex(global float64) {
+	sc.apdex = apdexThresholds{
+		service:   compileApdexThreshold("ApdexThreshold of "+sc.ServiceName(), sc.ApdexThreshold, global),
+		endpoints: make(map[string]float64, len(sc.EndpointApdexThresholds)),
+	}
+	for endpoint, value := range sc.EndpointApdexThresholds {
+		setting := "EndpointApdexThresholds of " + sc.ServiceName() + " " + endpoint
+		sc.apdex.endpoints[endpoint] = compileApdexThreshold(setting, value, sc.apdex.service)
+	}
+}
+
+// ApdexThresholdFor returns the Apdex T of an endpoint of the service in seconds,
+// falling back to the service's and then the global threshold
+func (c *TraefikOfficerConfig) ApdexThresholdFor(service, endpoint string) float64 {
+	if svc := c.Service(service); svc != nil {
+		if threshold, exists := svc.apdex.endpoints[endpoint]; exists {
+			return threshold
+		}
+		return svc.apdex.service
+	}
+	return c.apdexThreshold
+}
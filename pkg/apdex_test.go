@@ -0,0 +1,87 @@
+package main
+
+import "testing"
+
+func TestApdexZone(t *testing.T) {
+	tests := []struct {
+		name           string
+		duration       float64
+		status         int
+		wantSatisfied  bool
+		wantTolerating bool
+	}{
+		{name: "fast", duration: 0.1, status: 200, wantSatisfied: true},
+		{name: "at T", duration: 0.5, status: 200, wantSatisfied: true},
+		{name: "just over T", duration: 0.501, status: 200, wantTolerating: true},
+		{name: "at 4T", duration: 2, status: 200, wantTolerating: true},
+		{name: "over 4T", duration: 2.001, status: 200},
+		{name: "fast client error", duration: 0.1, status: 404, wantSatisfied: true},
+		{name: "slow client error", duration: 1, status: 429, wantTolerating: true},
+		{name: "fast server error", duration: 0.1, status: 500},
+		{name: "slow server error", duration: 1, status: 503},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			satisfied, tolerating := apdexZone(tt.duration, tt.status, 0.5)
+			if satisfied != tt.wantSatisfied || tolerating != tt.wantTolerating {
+				t.Errorf("apdexZone(%v, %d, 0.5) = %t, %t, want %t, %t", tt.duration, tt.status, satisfied, tolerating, tt.wantSatisfied, tt.wantTolerating)
+			}
+		})
+	}
+}
+
+func TestWindowSummaryApdex(t *testing.T) {
+	tests := []struct {
+		name    string
+		summary windowSummary
+		want    float64
+	}{
+		{name: "no requests", summary: windowSummary{}, want: 0},
+		{name: "all satisfied", summary: windowSummary{Requests: 4, Satisfied: 4}, want: 1},
+		{name: "tolerating count half", summary: windowSummary{Requests: 4, Satisfied: 2, Tolerating: 2}, want: 0.75},
+		{name: "all frustrated", summary: windowSummary{Requests: 4}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.summary.Apdex(); got != tt.want {
+				t.Errorf("Apdex() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApdexThresholdFor(t *testing.T) {
+	config := &TraefikOfficerConfig{
+		ApdexThreshold: "200ms",
+		Services: []ServiceConfig{{
+			Namespace:               "shop",
+			Name:                    "store",
+			ApdexThreshold:          "1s",
+			EndpointApdexThresholds: map[string]string{"/search": "2s", "/broken": "fast"},
+		}},
+	}
+	config.compile()
+	service := config.Services[0].Key()
+
+	tests := []struct {
+		name     string
+		service  string
+		endpoint string
+		want     float64
+	}{
+		{name: "endpoint override", service: service, endpoint: "/search", want: 2},
+		{name: "invalid endpoint override", service: service, endpoint: "/broken", want: 1},
+		{name: "service threshold", service: service, endpoint: "/cart", want: 1},
+		{name: "global threshold", service: "other-service", endpoint: "/search", want: 0.2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := config.ApdexThresholdFor(tt.service, tt.endpoint); got != tt.want {
+				t.Errorf("ApdexThresholdFor(%q, %q) = %v, want %v", tt.service, tt.endpoint, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	logger "github.com/sirupsen/logrus"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// defaultMaxBackendsPerService is the default budget of backend series per service
+	defaultMaxBackendsPerService = 50
+	// backendOverflowValue replaces backends beyond the budget
+	backendOverflowValue = "__other__"
+	// endpointSliceAddressIndex indexes EndpointSlices by the addresses of their endpoints
+	endpointSliceAddressIndex = "address"
+)
+
+var (
+	backendLabels = []string{"app", "backend", "pod"}
+
+	backendRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "traefik_officer_backend_requests_total",
+			Help: "Total number of HTTP requests per backend",
+		},
+		backendLabels,
+	)
+
+	backendErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "traefik_officer_backend_errors_total",
+			Help: "Total number of HTTP requests per backend answered with a 5xx or not answered at all",
+		},
+		backendLabels,
+	)
+
+	backendDuration = registerHistogramSet(
+		prometheus.HistogramOpts{
+			Name: "traefik_officer_backend_request_duration_seconds",
+			Help: "Duration of HTTP requests per backend in seconds, backend time only with JSON logs",
+		},
+		backendLabels,
+	)
+
+	backendOverflowRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "traefik_officer_backend_overflow_requests_total",
+			Help: "Requests counted under the __other__ backend because the service's backend budget was used up",
+		},
+		[]string{"app"},
+	)
+
+	backends = &backendGuard{seen: make(map[string]map[string]time.Time)}
+
+	// backendPods is nil unless backend pod resolution is enabled
+	backendPods *BackendPodResolver
+)
+
+// BackendMetricsConfig enables the per-backend metrics
+type BackendMetricsConfig struct {
+	Enabled bool `json:"Enabled"`
+	// MaxBackendsPerService caps the distinct backends exported per service, 50 by default
+	MaxBackendsPerService int `json:"MaxBackendsPerService"`
+}
+
+// backendAddress returns the host:port of the backend that served the request,
+// or an empty string if no backend was selected
+func backendAddress(entry *traefikLogConfig) string {
+	if entry.ServiceAddr != "" {
+		return entry.ServiceAddr
+	}
+	return entry.ServiceURL.Host()
+}
+
+// backendGuard keeps the backends of each service within budget. Backends idle
+// for longer than the series TTL give their place to new ones, so replaced pods
+// do not use up the budget.
+type backendGuard struct {
+	mu   sync.Mutex
+	seen map[string]map[string]time.Time // service -> backend -> last seen
+}
+
+// Admit returns backend, or the overflow value if the service has no room for it
+func (bg *backendGuard) Admit(service, backend string, budget int, idleTTL time.Duration) string {
+	now := time.Now()
+
+	bg.mu.Lock()
+	defer bg.mu.Unlock()
+
+	seen, exists := bg.seen[service]
+	if !exists {
+		seen = make(map[string]time.Time)
+		bg.seen[service] = seen
+	}
+	if _, known := seen[backend]; !known && len(seen) >= budget {
+		if idleTTL > 0 {
+			for address, lastSeen := range seen {
+				if now.Sub(lastSeen) > idleTTL {
+					delete(seen, address)
+				}
+			}
+		}
+		if len(seen) >= budget {
+			return backendOverflowValue
+		}
+	}
+	seen[backend] = now
+	return backend
+}
+
+// updateBackendMetrics records a request against the backend that served it
+func updateBackendMetrics(entry *traefikLogConfig, config *TraefikOfficerConfig, service string, status int) {
+	if !config.BackendMetrics.Enabled {
+		return
+	}
+	address := backendAddress(entry)
+	if address == "" {
+		return
+	}
+
+	budget := config.BackendMetrics.MaxBackendsPerService
+	if budget <= 0 {
+		budget = defaultMaxBackendsPerService
+	}
+	backend := backends.Admit(service, address, budget, config.SeriesIdleTTL())
+	pod := ""
+	if backend == backendOverflowValue {
+		backendOverflowRequests.WithLabelValues(service).Inc()
+		series.Touch("backend_overflow_requests_total", backendOverflowRequests, service)
+	} else {
+		pod = backendPods.PodName(address)
+	}
+
+	// With JSON logs the backend's own time is known
+	duration := entry.Duration / 1000.0
+	if entry.fromJSON && entry.OriginStatus > 0 {
+		duration = entry.OriginDuration / 1000.0
+	}
+
+	backendRequests.WithLabelValues(service, backend, pod).Inc()
+	backendDuration.WithLabelValues(config.LatencyHistogramFor(service, ""), service, backend, pod).Observe(duration)
+	series.Touch("backend_requests_total", backendRequests, service, backend, pod)
+	series.Touch("backend_request_duration_seconds", backendDuration, service, backend, pod)
+	if status >= 500 {
+		backendErrors.WithLabelValues(service, backend, pod).Inc()
+		series.Touch("backend_errors_total", backendErrors, service, backend, pod)
+	}
+}
+
+// BackendPodResolver maps backend addresses to the pods behind them through EndpointSlices
+type BackendPodResolver struct {
+	slices cache.Indexer
+}
+
+// NewBackendPodResolver registers an EndpointSlice informer indexed by endpoint address
+func NewBackendPodResolver(ki *KubernetesInformers) *BackendPodResolver {
+	informer := ki.Factory.Discovery().V1().EndpointSlices().Informer()
+	if err := informer.AddIndexers(cache.Indexers{endpointSliceAddressIndex: endpointSliceAddresses}); err != nil {
+		logger.Warnf("Failed to index EndpointSlices by address: %v", err)
+		return nil
+	}
+	logger.Info("Watching EndpointSlices to resolve backends to pods")
+	return &BackendPodResolver{slices: informer.GetIndexer()}
+}
+
+func endpointSliceAddresses(obj interface{}) ([]string, error) {
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok {
+		return nil, nil
+	}
+	var addresses []string
+	for _, endpoint := range slice.Endpoints {
+		addresses = append(addresses, endpoint.Addresses...)
+	}
+	return addresses, nil
+}
+
+// PodName returns the namespace/name of the pod serving the host:port address,
+// or an empty string if it is unknown
+func (r *BackendPodResolver) PodName(address string) string {
+	if r == nil {
+		return ""
+	}
+	host, portValue, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	port, _ := strconv.Atoi(portValue)
+
+	objects, err := r.slices.ByIndex(endpointSliceAddressIndex, host)
+	if err != nil {
+		return ""
+	}
+	for _, obj := range objects {
+		slice, ok := obj.(*discoveryv1.EndpointSlice)
+		if !ok || !endpointSliceHasPort(slice, port) {
+			continue
+		}
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.TargetRef == nil || endpoint.TargetRef.Kind != "Pod" {
+				continue
+			}
+			for _, endpointAddress := range endpoint.Addresses {
+				if endpointAddress == host {
+					return endpoint.TargetRef.Namespace + "/" + endpoint.TargetRef.Name
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// endpointSliceHasPort reports whether the slice exposes port. Pods on the host
+// network share the node's address, so the port tells them apart.
+func endpointSliceHasPort(slice *discoveryv1.EndpointSlice, port int) bool {
+	if port == 0 || len(slice.Ports) == 0 {
+		return true
+	}
+	for _, slicePort := range slice.Ports {
+		if slicePort.Port != nil && int(*slicePort.Port) == port {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestBackendAddress(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry traefikLogConfig
+		want  string
+	}{
+		{name: "service address", entry: traefikLogConfig{ServiceAddr: "10.1.0.7:8080", ServiceURL: "http://10.1.0.8:8080"}, want: "10.1.0.7:8080"},
+		{name: "service URL", entry: traefikLogConfig{ServiceURL: "http://10.1.0.8:8080/"}, want: "10.1.0.8:8080"},
+		{name: "no backend in a CLF log", entry: traefikLogConfig{ServiceURL: "-"}, want: ""},
+		{name: "no backend", entry: traefikLogConfig{}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := backendAddress(&tt.entry); got != tt.want {
+				t.Errorf("backendAddress() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackendGuardAdmit(t *testing.T) {
+	bg := &backendGuard{seen: make(map[string]map[string]time.Time)}
+	idle := func(service, backend string) {
+		bg.seen[service][backend] = time.Now().Add(-2 * time.Hour)
+	}
+
+	tests := []struct {
+		name    string
+		before  func()
+		service string
+		backend string
+		idleTTL time.Duration
+		want    string
+	}{
+		{name: "first backend", service: "shop-store", backend: "10.1.0.1:80", want: "10.1.0.1:80"},
+		{name: "second backend", service: "shop-store", backend: "10.1.0.2:80", want: "10.1.0.2:80"},
+		{name: "known backend within budget", service: "shop-store", backend: "10.1.0.1:80", want: "10.1.0.1:80"},
+		{name: "budget used up", service: "shop-store", backend: "10.1.0.3:80", want: backendOverflowValue},
+		{name: "other services have their own budget", service: "shop-cart", backend: "10.1.0.3:80", want: "10.1.0.3:80"},
+		{name: "idle backends are kept without a TTL", before: func() { idle("shop-store", "10.1.0.1:80") }, service: "shop-store", backend: "10.1.0.3:80", want: backendOverflowValue},
+		{name: "idle backends make room", service: "shop-store", backend: "10.1.0.3:80", idleTTL: time.Hour, want: "10.1.0.3:80"},
+		{name: "active backends are kept", service: "shop-store", backend: "10.1.0.4:80", idleTTL: time.Hour, want: backendOverflowValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.before != nil {
+				tt.before()
+			}
+			if got := bg.Admit(tt.service, tt.backend, 2, tt.idleTTL); got != tt.want {
+				t.Errorf("Admit(%q, %q) = %q, want %q", tt.service, tt.backend, got, tt.want)
+			}
+		})
+	}
+}
+
+// endpointSlice is a slice of the shop namespace with one endpoint per target
+func endpointSlice(name string, port int32, targets map[string]*v1.ObjectReference) *discoveryv1.EndpointSlice {
+	slice := &discoveryv1.EndpointSlice{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name}}
+	if port > 0 {
+		slice.Ports = []discoveryv1.EndpointPort{{Port: &port}}
+	}
+	for address, target := range targets {
+		slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{Addresses: []string{address}, TargetRef: target})
+	}
+	return slice
+}
+
+func TestBackendPodResolverPodName(t *testing.T) {
+	pod := func(name string) *v1.ObjectReference {
+		return &v1.ObjectReference{Kind: "Pod", Namespace: "shop", Name: name}
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{endpointSliceAddressIndex: endpointSliceAddresses})
+	for _, slice := range []*discoveryv1.EndpointSlice{
+		endpointSlice("store-abc", 8080, map[string]*v1.ObjectReference{"10.1.0.7": pod("store-1"), "10.1.0.8": pod("store-2")}),
+		// Two pods on the host network of the same node
+		endpointSlice("agent-abc", 9100, map[string]*v1.ObjectReference{"192.168.1.5": pod("agent-1")}),
+		endpointSlice("proxy-abc", 3128, map[string]*v1.ObjectReference{"192.168.1.5": pod("proxy-1")}),
+		endpointSlice("legacy-abc", 80, map[string]*v1.ObjectReference{"10.2.0.1": {Kind: "Node", Name: "node-1"}, "10.2.0.2": nil}),
+		endpointSlice("portless-abc", 0, map[string]*v1.ObjectReference{"10.3.0.1": pod("portless-1")}),
+	} {
+		if err := indexer.Add(slice); err != nil {
+			t.Fatalf("adding %s: %v", slice.Name, err)
+		}
+	}
+	resolver := &BackendPodResolver{slices: indexer}
+
+	tests := []struct {
+		name    string
+		address string
+		want    string
+	}{
+		{name: "pod address", address: "10.1.0.8:8080", want: "shop/store-2"},
+		{name: "address without port", address: "10.1.0.7", want: "shop/store-1"},
+		{name: "host network by port", address: "192.168.1.5:3128", want: "shop/proxy-1"},
+		{name: "host network other port", address: "192.168.1.5:9100", want: "shop/agent-1"},
+		{name: "port not exposed", address: "10.1.0.7:9090", want: ""},
+		{name: "slice without ports", address: "10.3.0.1:1234", want: "shop/portless-1"},
+		{name: "target that is not a pod", address: "10.2.0.1:80", want: ""},
+		{name: "endpoint without target", address: "10.2.0.2:80", want: ""},
+		{name: "unknown address", address: "10.9.9.9:80", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolver.PodName(tt.address); got != tt.want {
+				t.Errorf("PodName(%q) = %q, want %q", tt.address, got, tt.want)
+			}
+		})
+	}
+
+	var disabled *BackendPodResolver
+	if got := disabled.PodName("10.1.0.7:8080"); got != "" {
+		t.Errorf("PodName without a resolver = %q, want none", got)
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	// collapsedSegment replaces the values of a segment position collapsed by the guard
+	collapsedSegment = "{collapsed}"
+	// overflowEndpoint receives the requests of new endpoints once the budget is used up
+	overflowEndpoint = "{overflow}"
+
+	defaultMaxEndpointsPerService = 1000
+	// A position is only collapsed when it holds at least this share of the budget
+	collapseMinShare = 4
+)
+
+var (
+	serviceEndpoints = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "traefik_officer_service_endpoints",
+			Help: "Number of distinct endpoints tracked per service",
+		},
+		[]string{"service"},
+	)
+
+	collapsedEndpoints = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "traefik_officer_collapsed_endpoints_total",
+			Help: "Endpoints merged into another by the cardinality guard collapsing a path segment position",
+		},
+		[]string{"service"},
+	)
+
+	overflowRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "traefik_officer_overflow_requests_total",
+			Help: "Requests reported as the {overflow} endpoint because the service used up its endpoint budget",
+		},
+		[]string{"service"},
+	)
+
+	endpointGuard = &cardinalityGuard{services: make(map[string]*serviceCardinality)}
+)
+
+// serviceCardinality is the endpoint set and collapsed positions of one service
+type serviceCardinality struct {
+	endpoints map[string]bool
+	collapsed map[string]bool // path prefixes whose next segment is collapsed
+	// children counts the tracked endpoints by path prefix and next segment,
+	// outside collapsed positions, so the widest position is found without a scan
+	children    map[string]map[string]int
+	widest      string // prefix with the most distinct next segments
+	widestStale bool   // set when an endpoint was removed from the widest position
+	overflowed  bool
+}
+
+func newServiceCardinality() *serviceCardinality {
+	return &serviceCardinality{
+		endpoints: make(map[string]bool),
+		collapsed: make(map[string]bool),
+		children:  make(map[string]map[string]int),
+	}
+}
+
+// cardinalityGuard keeps the number of endpoints per service within budget.
+// When a new endpoint would exceed it, the segment position with the most
+// distinct values is collapsed; if no position stands out the request goes
+// to the {overflow} endpoint.
+type cardinalityGuard struct {
+	mu       sync.Mutex
+	services map[string]*serviceCardinality
+}
+
+// Admit returns the endpoint the request is reported under
+func (g *cardinalityGuard) Admit(service, endpoint string, budget int) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	sc, exists := g.services[service]
+	if !exists {
+		sc = newServiceCardinality()
+		g.services[service] = sc
+	}
+
+	endpoint = sc.applyCollapsed(endpoint)
+	if sc.endpoints[endpoint] {
+		return endpoint
+	}
+
+	if len(sc.endpoints) >= budget {
+		if prefix, distinct := sc.widestPosition(endpoint); distinct*collapseMinShare >= budget {
+			g.collapse(service, sc, prefix, distinct)
+			endpoint = sc.applyCollapsed(endpoint)
+		}
+	}
+
+	if !sc.endpoints[endpoint] && len(sc.endpoints) >= budget {
+		if !sc.overflowed {
+			sc.overflowed = true
+			logger.Warnf("Service %s exceeded its budget of %d endpoints, new endpoints are reported as %s", service, budget, overflowEndpoint)
+		}
+		overflowRequests.WithLabelValues(service).Inc()
+		series.Touch("overflow_requests_total", overflowRequests, service)
+		return overflowEndpoint
+	}
+
+	sc.add(endpoint)
+	serviceEndpoints.WithLabelValues(service).Set(float64(len(sc.endpoints)))
+	series.Touch("service_endpoints", serviceEndpoints, service)
+	return endpoint
+}
+
+// Forget removes an expired endpoint so it no longer counts against the budget
+func (g *cardinalityGuard) Forget(service, endpoint string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	sc, exists := g.services[service]
+	if !exists {
+		return
+	}
+	sc.remove(endpoint)
+	if len(sc.endpoints) == 0 {
+		delete(g.services, service)
+		serviceEndpoints.DeleteLabelValues(service)
+		return
+	}
+	serviceEndpoints.WithLabelValues(service).Set(float64(len(sc.endpoints)))
+}
+
+// splitEndpoint splits an endpoint into path segments and the query suffix
+func splitEndpoint(endpoint string) ([]string, string) {
+	path, query, hasQuery := strings.Cut(endpoint, "?")
+	if hasQuery {
+		query = "?" + query
+	}
+	return strings.Split(strings.TrimPrefix(path, "/"), "/"), query
+}
+
+// applyCollapsed replaces the segments at collapsed positions
+func (sc *serviceCardinality) applyCollapsed(endpoint string) string {
+	if len(sc.collapsed) == 0 {
+		return endpoint
+	}
+	segments, query := splitEndpoint(endpoint)
+	changed := false
+	for i := range segments {
+		if sc.collapsed[strings.Join(segments[:i], "/")] && segments[i] != collapsedSegment {
+			segments[i] = collapsedSegment
+			changed = true
+		}
+	}
+	if !changed {
+		return endpoint
+	}
+	return "/" + strings.Join(segments, "/") + query
+}
+
+// add tracks an endpoint and counts its segments
+func (sc *serviceCardinality) add(endpoint string) {
+	if sc.endpoints[endpoint] {
+		return
+	}
+	sc.endpoints[endpoint] = true
+	sc.forEachPosition(endpoint, func(prefix, segment string) {
+		if sc.children[prefix] == nil {
+			sc.children[prefix] = make(map[string]int)
+		}
+		sc.children[prefix][segment]++
+		if len(sc.children[prefix]) > len(sc.children[sc.widest]) {
+			sc.widest = prefix
+		}
+	})
+}
+
+// remove stops tracking an endpoint and its segments
+func (sc *serviceCardinality) remove(endpoint string) {
+	if !sc.endpoints[endpoint] {
+		return
+	}
+	delete(sc.endpoints, endpoint)
+	sc.forEachPosition(endpoint, func(prefix, segment string) {
+		segments := sc.children[prefix]
+		if segments[segment]--; segments[segment] > 0 {
+			return
+		}
+		delete(segments, segment)
+		if len(segments) == 0 {
+			delete(sc.children, prefix)
+		}
+		if prefix == sc.widest {
+			sc.widestStale = true
+		}
+	})
+}
+
+// forEachPosition calls fn with each uncollapsed prefix of the endpoint and the segment after it
+func (sc *serviceCardinality) forEachPosition(endpoint string, fn func(prefix, segment string)) {
+	segments, _ := splitEndpoint(endpoint)
+	for i := range segments {
+		prefix := strings.Join(segments[:i], "/")
+		if !sc.collapsed[prefix] {
+			fn(prefix, segments[i])
+		}
+	}
+}
+
+// widestPosition finds the path prefix with the most distinct next segments
+// across the tracked endpoints and the new one. Only the new endpoint's own
+// positions are looked at, the widest one among the tracked endpoints is kept
+// up to date as they are added and only searched for after removals.
+func (sc *serviceCardinality) widestPosition(endpoint string) (string, int) {
+	if sc.widestStale {
+		sc.widest = ""
+		for prefix, segments := range sc.children {
+			if len(segments) > len(sc.children[sc.widest]) {
+				sc.widest = prefix
+			}
+		}
+		sc.widestStale = false
+	}
+
+	widest, distinct := sc.widest, len(sc.children[sc.widest])
+	sc.forEachPosition(endpoint, func(prefix, segment string) {
+		n := len(sc.children[prefix])
+		if sc.children[prefix][segment] == 0 {
+			n++
+		}
+		if n > distinct {
+			widest, distinct = prefix, n
+		}
+	})
+	return widest, distinct
+}
+
+// collapse marks the position after prefix as collapsed and merges the tracked
+// endpoints and their stats. Series of the merged endpoints stop being updated.
+func (g *cardinalityGuard) collapse(service string, sc *serviceCardinality, prefix string, distinct int) {
+	sc.collapsed[prefix] = true
+
+	merged := make(map[string]string)
+	endpoints := sc.endpoints
+	sc.endpoints = make(map[string]bool, len(endpoints))
+	sc.children = make(map[string]map[string]int)
+	sc.widest, sc.widestStale = "", false
+	for e := range endpoints {
+		collapsed := sc.applyCollapsed(e)
+		if collapsed != e {
+			merged[e] = collapsed
+		}
+		sc.add(collapsed)
+	}
+	removed := len(endpoints) - len(sc.endpoints)
+
+	endpointStatsMutex.Lock()
+	for from, to := range merged {
+		fromKey, toKey := fmt.Sprintf("%s:%s", service, from), fmt.Sprintf("%s:%s", service, to)
+		stat, exists := endpointStats[fromKey]
+		if !exists {
+			continue
+		}
+		delete(endpointStats, fromKey)
+		target, exists := endpointStats[toKey]
+		if !exists {
+			endpointStats[toKey] = stat
+			continue
+		}
+		target.mu.Lock()
+		stat.mu.Lock()
+		target.merge(stat)
+		stat.retired = true
+		stat.mu.Unlock()
+		target.mu.Unlock()
+	}
+	endpointStatsMutex.Unlock()
+
+	collapsedEndpoints.WithLabelValues(service).Add(float64(removed))
+	series.Touch("collapsed_endpoints_total", collapsedEndpoints, service)
+	serviceEndpoints.WithLabelValues(service).Set(float64(len(sc.endpoints)))
+	position := collapsedSegment
+	if prefix != "" {
+		position = prefix + "/" + collapsedSegment
+	}
+	logger.Warnf("Service %s exceeded its endpoint budget, collapsed /%s (%d distinct values, %d endpoints merged)",
+		service, position, distinct, removed)
+}
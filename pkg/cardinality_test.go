@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCardinalityGuardAdmit(t *testing.T) {
+	// Sixteen endpoints four levels deep with two values per level
+	var balanced []string
+	for i := 0; i < 16; i++ {
+		balanced = append(balanced, fmt.Sprintf("/%c/%c/%c/%c", 'a'+i>>3&1, 'a'+i>>2&1, 'a'+i>>1&1, 'a'+i&1))
+	}
+
+	tests := []struct {
+		name      string
+		endpoints []string
+		budget    int
+		endpoint  string
+		want      string
+	}{
+		{
+			name:      "within budget",
+			endpoints: []string{"/a", "/b"},
+			budget:    10,
+			endpoint:  "/c",
+			want:      "/c",
+		},
+		{
+			name:      "widest position collapses",
+			endpoints: []string{"/users/a/orders", "/users/b/orders", "/users/c/orders", "/users/d/orders", "/users/e/orders", "/users/f/orders", "/health", "/ready"},
+			budget:    8,
+			endpoint:  "/users/g/orders",
+			want:      "/users/{collapsed}/orders",
+		},
+		{
+			name:      "no position stands out",
+			endpoints: balanced,
+			budget:    16,
+			endpoint:  "/a/a/a/c",
+			want:      overflowEndpoint,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := "cardinality-test"
+			guard := &cardinalityGuard{services: make(map[string]*serviceCardinality)}
+			for _, endpoint := range tt.endpoints {
+				guard.Admit(service, endpoint, tt.budget)
+			}
+			if got := guard.Admit(service, tt.endpoint, tt.budget); got != tt.want {
+				t.Errorf("Admit(%q) = %q, want %q", tt.endpoint, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCardinalityGuardCounts checks the incremental segment counts against a
+// recount after admissions, removals and a collapse
+func TestCardinalityGuardCounts(t *testing.T) {
+	guard := &cardinalityGuard{services: make(map[string]*serviceCardinality)}
+	for i := 0; i < 8; i++ {
+		guard.Admit("counts-test", fmt.Sprintf("/items/%d", i), 10)
+	}
+	guard.Admit("counts-test", "/health", 10)
+	guard.Forget("counts-test", "/items/3")
+	guard.Forget("counts-test", "/items/4")
+	sc := guard.services["counts-test"]
+
+	if prefix, distinct := sc.widestPosition("/items/new"); prefix != "items" || distinct != 7 {
+		t.Errorf("widestPosition = %q, %d, want items, 7", prefix, distinct)
+	}
+
+	for i := 10; i < 14; i++ {
+		guard.Admit("counts-test", fmt.Sprintf("/items/%d", i), 10)
+	}
+	if !sc.collapsed["items"] {
+		t.Fatal("/items/* was not collapsed")
+	}
+	recount := newServiceCardinality()
+	recount.collapsed = sc.collapsed
+	for endpoint := range sc.endpoints {
+		recount.add(endpoint)
+	}
+	if fmt.Sprint(recount.children) != fmt.Sprint(sc.children) {
+		t.Errorf("children = %v, want %v", sc.children, recount.children)
+	}
+}
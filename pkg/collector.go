@@ -0,0 +1,169 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	endpointGaugeLabels = []string{"app", "request_path", "window"}
+
+	endpointGauges = registerEndpointStatsCollector()
+)
+
+// endpointStatsCollector computes the windowed endpoint gauges from the endpoint
+// stats when collected. Nothing is reset, so every scraper sees the same values.
+type endpointStatsCollector struct {
+	avgLatency      *prometheus.Desc
+	maxLatency      *prometheus.Desc
+	requestRate     *prometheus.Desc
+	errorRate       *prometheus.Desc
+	clientErrorRate *prometheus.Desc
+	serverErrorRate *prometheus.Desc
+	latencyQuantile *prometheus.Desc
+	apdex           *prometheus.Desc
+	serviceApdex    *prometheus.Desc
+	throughput      *prometheus.Desc
+	overheadRatio   *prometheus.Desc
+	retriedSuccess  *prometheus.Desc
+	serviceRetried  *prometheus.Desc
+}
+
+// registerEndpointStatsCollector creates the collector and registers it with the default registry
+func registerEndpointStatsCollector() *endpointStatsCollector {
+	c := &endpointStatsCollector{
+		avgLatency: prometheus.NewDesc("traefik_officer_endpoint_avg_latency_seconds",
+			"Average latency per endpoint in seconds over the window", endpointGaugeLabels, nil),
+		maxLatency: prometheus.NewDesc("traefik_officer_endpoint_max_latency_seconds",
+			"Maximum latency per endpoint in seconds over the window", endpointGaugeLabels, nil),
+		requestRate: prometheus.NewDesc("traefik_officer_endpoint_requests_per_second",
+			"Requests per second per endpoint over the window", endpointGaugeLabels, nil),
+		errorRate: prometheus.NewDesc("traefik_officer_endpoint_error_rate",
+			"Error rate per endpoint (ratio of 4xx/5xx responses) over the window", endpointGaugeLabels, nil),
+		clientErrorRate: prometheus.NewDesc("traefik_officer_endpoint_client_error_rate",
+			"Error rate per endpoint (ratio of 4xx responses) over the window", endpointGaugeLabels, nil),
+		serverErrorRate: prometheus.NewDesc("traefik_officer_endpoint_server_error_rate",
+			"Error rate per endpoint (ratio of 5xx responses) over the window", endpointGaugeLabels, nil),
+		latencyQuantile: prometheus.NewDesc("traefik_officer_endpoint_latency_quantile_seconds",
+			"Latency quantiles per endpoint in seconds over the window, estimated with a DDSketch",
+			append(append([]string{}, endpointGaugeLabels...), "quantile"), nil),
+		apdex: prometheus.NewDesc("traefik_officer_endpoint_apdex",
+			"Apdex score per endpoint over the window", endpointGaugeLabels, nil),
+		serviceApdex: prometheus.NewDesc("traefik_officer_service_apdex",
+			"Apdex score per service over the window, covering all of its endpoints", []string{"app", "window"}, nil),
+		throughput: prometheus.NewDesc("traefik_officer_endpoint_throughput_bytes_per_second",
+			"Response bytes per second of request duration per endpoint over the window", endpointGaugeLabels, nil),
+		overheadRatio: prometheus.NewDesc("traefik_officer_endpoint_overhead_ratio",
+			"Share of request duration spent in Traefik and its middlewares per endpoint over the window, JSON logs only", endpointGaugeLabels, nil),
+		retriedSuccess: prometheus.NewDesc("traefik_officer_endpoint_retried_success_ratio",
+			"Share of successful responses per endpoint that needed at least one retry over the window, JSON logs only", endpointGaugeLabels, nil),
+		serviceRetried: prometheus.NewDesc("traefik_officer_service_retried_success_ratio",
+			"Share of successful responses per service that needed at least one retry over the window, JSON logs only", []string{"app", "window"}, nil),
+	}
+	prometheus.MustRegister(c)
+	return c
+}
+
+func (c *endpointStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.avgLatency
+	ch <- c.maxLatency
+	ch <- c.requestRate
+	ch <- c.errorRate
+	ch <- c.clientErrorRate
+	ch <- c.serverErrorRate
+	ch <- c.latencyQuantile
+	ch <- c.apdex
+	ch <- c.serviceApdex
+	ch <- c.throughput
+	ch <- c.overheadRatio
+	ch <- c.retriedSuccess
+	ch <- c.serviceRetried
+}
+
+// Collect exports latency, request rate, Apdex, throughput and overhead for top paths, error rates for
+// top paths and every other endpoint with errors in the window and the Apdex
+// and retried successes of every service
+func (c *endpointStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+	config := CurrentConfig()
+	windows := config.Windows()
+	quantileLabels := make([]string, len(config.Quantiles))
+	for i, q := range config.Quantiles {
+		quantileLabels[i] = strconv.FormatFloat(q, 'f', -1, 64)
+	}
+
+	topPathsMutex.RLock()
+	defer topPathsMutex.RUnlock()
+	endpointStatsMutex.RLock()
+	defer endpointStatsMutex.RUnlock()
+
+	gauge := func(desc *prometheus.Desc, value float64, lvs ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, lvs...)
+	}
+
+	// Apdex and retry counts of each service, by window label
+	services := make(map[string]map[string]*windowSummary)
+
+	for key, stat := range endpointStats {
+		parts := strings.SplitN(key, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		service, endpoint := parts[0], parts[1]
+		isTopPath := topPathsPerService[service][key]
+
+		for _, window := range windows {
+			summary, exists := stat.Window(window, now)
+			if !exists || summary.Requests == 0 {
+				continue
+			}
+			if services[service] == nil {
+				services[service] = make(map[string]*windowSummary, len(windows))
+			}
+			if services[service][window.label] == nil {
+				services[service][window.label] = &windowSummary{}
+			}
+			total := services[service][window.label]
+			total.Requests += summary.Requests
+			total.Satisfied += summary.Satisfied
+			total.Tolerating += summary.Tolerating
+			total.DetailedSuccesses += summary.DetailedSuccesses
+			total.RetriedSuccesses += summary.RetriedSuccesses
+
+			if isTopPath {
+				gauge(c.avgLatency, summary.AvgLatency(), service, endpoint, window.label)
+				gauge(c.maxLatency, summary.MaxDuration, service, endpoint, window.label)
+				gauge(c.requestRate, summary.RequestRate(), service, endpoint, window.label)
+				for i, q := range config.Quantiles {
+					gauge(c.latencyQuantile, summary.Quantile(q), service, endpoint, window.label, quantileLabels[i])
+				}
+				gauge(c.apdex, summary.Apdex(), service, endpoint, window.label)
+				gauge(c.throughput, summary.Throughput(), service, endpoint, window.label)
+				if summary.TimedDuration > 0 {
+					gauge(c.overheadRatio, summary.OverheadRatio(), service, endpoint, window.label)
+				}
+				if summary.DetailedSuccesses > 0 {
+					gauge(c.retriedSuccess, summary.RetriedSuccessRatio(), service, endpoint, window.label)
+				}
+			}
+			// Top paths read 0 when healthy, other endpoints only show up once they fail
+			if isTopPath || summary.Errors > 0 {
+				gauge(c.errorRate, summary.ErrorRate(), service, endpoint, window.label)
+				gauge(c.clientErrorRate, summary.ClientErrorRate(), service, endpoint, window.label)
+				gauge(c.serverErrorRate, summary.ServerErrorRate(), service, endpoint, window.label)
+			}
+		}
+	}
+
+	for service, summaries := range services {
+		for label, summary := range summaries {
+			gauge(c.serviceApdex, summary.Apdex(), service, label)
+			if summary.DetailedSuccesses > 0 {
+				gauge(c.serviceRetried, summary.RetriedSuccessRatio(), service, label)
+			}
+		}
+	}
+}
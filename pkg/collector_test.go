@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestEndpointStatsCollectorErrorRates(t *testing.T) {
+	config := CurrentConfig()
+	now := time.Now()
+
+	healthy := newEndpointStat(config.Windows())
+	healthy.observe(now, requestObservation{duration: 0.1, status: 200})
+	failing := newEndpointStat(config.Windows())
+	failing.observe(now, requestObservation{duration: 0.1, status: 200})
+	failing.observe(now, requestObservation{duration: 0.1, status: 503})
+	quiet := newEndpointStat(config.Windows())
+	quiet.observe(now, requestObservation{duration: 0.1, status: 200})
+
+	endpointStatsMutex.Lock()
+	endpointStats["collector-test:/healthy"] = healthy
+	endpointStats["collector-test:/failing"] = failing
+	endpointStats["collector-test:/quiet"] = quiet
+	endpointStatsMutex.Unlock()
+	topPathsMutex.Lock()
+	topPathsPerService["collector-test"] = map[string]bool{"collector-test:/healthy": true}
+	topPathsMutex.Unlock()
+	defer func() {
+		endpointStatsMutex.Lock()
+		delete(endpointStats, "collector-test:/healthy")
+		delete(endpointStats, "collector-test:/failing")
+		delete(endpointStats, "collector-test:/quiet")
+		endpointStatsMutex.Unlock()
+		topPathsMutex.Lock()
+		delete(topPathsPerService, "collector-test")
+		topPathsMutex.Unlock()
+	}()
+
+	var expected strings.Builder
+	expected.WriteString("# HELP traefik_officer_endpoint_error_rate Error rate per endpoint (ratio of 4xx/5xx responses) over the window\n# TYPE traefik_officer_endpoint_error_rate gauge\n")
+	for _, window := range config.Windows() {
+		expected.WriteString(`traefik_officer_endpoint_error_rate{app="collector-test",request_path="/failing",window="` + window.label + `"} 0.5` + "\n")
+		expected.WriteString(`traefik_officer_endpoint_error_rate{app="collector-test",request_path="/healthy",window="` + window.label + `"} 0` + "\n")
+	}
+	if err := testutil.CollectAndCompare(endpointGauges, strings.NewReader(expected.String()), "traefik_officer_endpoint_error_rate"); err != nil {
+		t.Error(err)
+	}
+}
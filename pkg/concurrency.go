@@ -0,0 +1,269 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultMaxConcurrencyIntervals is the default number of requests kept per service and top path
+const defaultMaxConcurrencyIntervals = 10000
+
+// clfTimeLayout is the timestamp layout of CLF access logs
+const clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// clfReadSlack is how far the read time of a CLF line may stray from its
+// logged second for the read time to place the request within that second
+const clfReadSlack = 2 * time.Second
+
+var (
+	concurrency = &concurrencyEstimator{intervals: make(map[string]*intervalRing)}
+
+	concurrencyGauges = registerConcurrencyCollector()
+)
+
+// ConcurrencyConfig enables the estimate of in-flight requests
+type ConcurrencyConfig struct {
+	Enabled bool `json:"Enabled"`
+	// MaxIntervals caps the requests kept per service and top path, 10000 by default.
+	// The oldest requests are dropped first, shortening the span the estimate covers.
+	MaxIntervals int `json:"MaxIntervals"`
+}
+
+// requestInterval is the time a request was in flight, in nanoseconds since the epoch
+type requestInterval struct {
+	start int64
+	end   int64
+}
+
+// intervalRing keeps the most recent request intervals
+type intervalRing struct {
+	intervals []requestInterval
+	next      int
+	latestEnd int64
+	full      bool // older requests were dropped to make room
+}
+
+func (r *intervalRing) add(interval requestInterval, capacity int) {
+	if interval.end > r.latestEnd {
+		r.latestEnd = interval.end
+	}
+	if len(r.intervals) < capacity {
+		r.intervals = append(r.intervals, interval)
+		return
+	}
+	r.intervals[r.next%len(r.intervals)] = interval
+	r.next = (r.next + 1) % len(r.intervals)
+	r.full = true
+}
+
+// snapshot copies the ring so it can be estimated without holding the lock
+func (r *intervalRing) snapshot() *intervalRing {
+	return &intervalRing{
+		intervals: append([]requestInterval(nil), r.intervals...),
+		next:      r.next,
+		latestEnd: r.latestEnd,
+		full:      r.full,
+	}
+}
+
+// concurrencyEstimate is the number of requests in flight over a window
+type concurrencyEstimate struct {
+	Peak    int
+	Average float64
+}
+
+// estimate sweeps over the starts and ends of the requests overlapping the window.
+// Once older requests were dropped, the window starts at the oldest kept request
+// so the average is not diluted by the span nothing is known about.
+func (r *intervalRing) estimate(from, to int64) concurrencyEstimate {
+	type event struct {
+		at    int64
+		delta int
+	}
+	if r.full {
+		oldest := to
+		for _, interval := range r.intervals {
+			oldest = min(oldest, interval.start)
+		}
+		from = max(from, oldest)
+	}
+	if from >= to {
+		return concurrencyEstimate{}
+	}
+	events := make([]event, 0, 2*len(r.intervals))
+	var busy int64
+	for _, interval := range r.intervals {
+		if interval.end <= from || interval.start >= to {
+			continue
+		}
+		start, end := max(interval.start, from), min(interval.end, to)
+		busy += end - start
+		events = append(events, event{start, 1}, event{end, -1})
+	}
+	// A request ending when another starts does not overlap it
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].at != events[j].at {
+			return events[i].at < events[j].at
+		}
+		return events[i].delta < events[j].delta
+	})
+
+	estimate := concurrencyEstimate{Average: float64(busy) / float64(to-from)}
+	inFlight := 0
+	for _, e := range events {
+		inFlight += e.delta
+		if inFlight > estimate.Peak {
+			estimate.Peak = inFlight
+		}
+	}
+	return estimate
+}
+
+// concurrencyEstimator rebuilds the requests in flight per service and top path
+// from the start time and duration of each request
+type concurrencyEstimator struct {
+	mu        sync.Mutex
+	intervals map[string]*intervalRing // by service, or service:endpoint for top paths
+}
+
+// requestStart returns when the request started, falling back to its duration
+// before the line was read. CLF start times only have second resolution, which
+// would start all requests of a second at once and inflate the peak, so they
+// are placed within their second by the read time as well. Lines read long
+// after they were logged, such as a backlog, keep the logged second.
+func requestStart(entry *traefikLogConfig, duration time.Duration, readAt time.Time) time.Time {
+	estimated := readAt.Add(-duration)
+	if start, err := time.Parse(time.RFC3339Nano, entry.StartUTC); err == nil {
+		return start
+	}
+	second, err := time.Parse(clfTimeLayout, entry.StartUTC)
+	if err != nil {
+		return estimated
+	}
+	end := second.Add(time.Second)
+	switch {
+	case estimated.Before(second.Add(-clfReadSlack)) || !estimated.Before(end.Add(clfReadSlack)):
+		// Read too far from the logged second to tell where in it the request started
+		return second
+	case estimated.Before(second):
+		return second
+	case !estimated.Before(end):
+		return end.Add(-time.Nanosecond)
+	}
+	return estimated
+}
+
+// Observe records the interval of a request against its service and, if it is a
+// top path, its endpoint key
+func (ce *concurrencyEstimator) Observe(entry *traefikLogConfig, config *TraefikOfficerConfig, service, key string, isTopPath bool) {
+	if !config.Concurrency.Enabled {
+		return
+	}
+	capacity := config.Concurrency.MaxIntervals
+	if capacity <= 0 {
+		capacity = defaultMaxConcurrencyIntervals
+	}
+
+	duration := time.Duration(entry.Duration * float64(time.Millisecond))
+	// Lines are observed as soon as they are read
+	start := requestStart(entry, duration, time.Now())
+	interval := requestInterval{start: start.UnixNano(), end: start.Add(duration).UnixNano()}
+	if interval.end == interval.start {
+		interval.end++ // a request is in flight for at least an instant
+	}
+
+	ce.mu.Lock()
+	defer ce.mu.Unlock()
+	ce.ring(service).add(interval, capacity)
+	if isTopPath {
+		ce.ring(key).add(interval, capacity)
+	}
+}
+
+// ring returns the intervals of key, creating them if needed. The caller holds the lock.
+func (ce *concurrencyEstimator) ring(key string) *intervalRing {
+	ring, exists := ce.intervals[key]
+	if !exists {
+		ring = &intervalRing{}
+		ce.intervals[key] = ring
+	}
+	return ring
+}
+
+// concurrencyCollector exports the in-flight estimates computed when collected
+type concurrencyCollector struct {
+	servicePeak     *prometheus.Desc
+	serviceAverage  *prometheus.Desc
+	endpointPeak    *prometheus.Desc
+	endpointAverage *prometheus.Desc
+}
+
+// registerConcurrencyCollector creates the collector and registers it with the default registry
+func registerConcurrencyCollector() *concurrencyCollector {
+	serviceLabels := []string{"app", "window"}
+	c := &concurrencyCollector{
+		servicePeak: prometheus.NewDesc("traefik_officer_service_concurrency_peak",
+			"Peak number of requests in flight per service over the window", serviceLabels, nil),
+		serviceAverage: prometheus.NewDesc("traefik_officer_service_concurrency_average",
+			"Average number of requests in flight per service over the window", serviceLabels, nil),
+		endpointPeak: prometheus.NewDesc("traefik_officer_endpoint_concurrency_peak",
+			"Peak number of requests in flight per endpoint over the window", endpointGaugeLabels, nil),
+		endpointAverage: prometheus.NewDesc("traefik_officer_endpoint_concurrency_average",
+			"Average number of requests in flight per endpoint over the window", endpointGaugeLabels, nil),
+	}
+	prometheus.MustRegister(c)
+	return c
+}
+
+func (c *concurrencyCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.servicePeak
+	ch <- c.serviceAverage
+	ch <- c.endpointPeak
+	ch <- c.endpointAverage
+}
+
+// Collect exports the estimates of every window and forgets keys without
+// requests in the longest one
+func (c *concurrencyCollector) Collect(ch chan<- prometheus.Metric) {
+	windows := CurrentConfig().Windows()
+	now := time.Now().UnixNano()
+	var retention int64
+	for _, window := range windows {
+		retention = max(retention, int64(window.length))
+	}
+
+	gauge := func(desc *prometheus.Desc, value float64, lvs ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, lvs...)
+	}
+
+	// Sorting the events is the expensive part, so it runs on copies of the
+	// rings without blocking the log tailer
+	rings := make(map[string]*intervalRing)
+	concurrency.mu.Lock()
+	for key, ring := range concurrency.intervals {
+		if ring.latestEnd < now-retention {
+			delete(concurrency.intervals, key)
+			continue
+		}
+		rings[key] = ring.snapshot()
+	}
+	concurrency.mu.Unlock()
+
+	for key, ring := range rings {
+		service, endpoint, isEndpoint := strings.Cut(key, ":")
+		for _, window := range windows {
+			estimate := ring.estimate(now-int64(window.length), now)
+			if isEndpoint {
+				gauge(c.endpointPeak, float64(estimate.Peak), service, endpoint, window.label)
+				gauge(c.endpointAverage, estimate.Average, service, endpoint, window.label)
+			} else {
+				gauge(c.servicePeak, float64(estimate.Peak), service, window.label)
+				gauge(c.serviceAverage, estimate.Average, service, window.label)
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIntervalRingEstimate(t *testing.T) {
+	tests := []struct {
+		name      string
+		intervals []requestInterval
+		capacity  int
+		from, to  int64
+		want      concurrencyEstimate
+	}{
+		{
+			name: "no requests",
+			from: 0, to: 100,
+			want: concurrencyEstimate{},
+		},
+		{
+			name:      "one request over half the window",
+			intervals: []requestInterval{{start: 0, end: 50}},
+			from:      0, to: 100,
+			want: concurrencyEstimate{Peak: 1, Average: 0.5},
+		},
+		{
+			name:      "overlapping requests",
+			intervals: []requestInterval{{start: 0, end: 60}, {start: 20, end: 80}, {start: 40, end: 100}},
+			from:      0, to: 100,
+			want: concurrencyEstimate{Peak: 3, Average: 1.8},
+		},
+		{
+			name:      "back to back requests do not overlap",
+			intervals: []requestInterval{{start: 0, end: 50}, {start: 50, end: 100}},
+			from:      0, to: 100,
+			want: concurrencyEstimate{Peak: 1, Average: 1},
+		},
+		{
+			name:      "requests are clipped to the window",
+			intervals: []requestInterval{{start: -100, end: 50}, {start: 80, end: 300}, {start: 200, end: 300}},
+			from:      0, to: 100,
+			want: concurrencyEstimate{Peak: 1, Average: 0.7},
+		},
+		{
+			name:      "dropped requests shorten the window",
+			intervals: []requestInterval{{start: 0, end: 10}, {start: 60, end: 80}, {start: 80, end: 100}},
+			capacity:  2,
+			from:      0, to: 100,
+			want: concurrencyEstimate{Peak: 1, Average: 1},
+		},
+		{
+			name:      "window shorter than the kept requests",
+			intervals: []requestInterval{{start: 0, end: 10}, {start: 20, end: 60}, {start: 50, end: 100}},
+			capacity:  2,
+			from:      50, to: 100,
+			want: concurrencyEstimate{Peak: 2, Average: 1.2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			capacity := tt.capacity
+			if capacity == 0 {
+				capacity = len(tt.intervals)
+			}
+			ring := &intervalRing{}
+			for _, interval := range tt.intervals {
+				ring.add(interval, capacity)
+			}
+			if got := ring.snapshot().estimate(tt.from, tt.to); got != tt.want {
+				t.Errorf("estimate(%d, %d) = %+v, want %+v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestStart(t *testing.T) {
+	logged := time.Date(2024, 5, 1, 10, 0, 7, 0, time.UTC)
+	clf := logged.Format(clfTimeLayout)
+
+	tests := []struct {
+		name     string
+		startUTC string
+		duration time.Duration
+		readAt   time.Time
+		want     time.Time
+	}{
+		{name: "JSON start", startUTC: "2024-05-01T10:00:07.123456789Z", duration: time.Second, readAt: logged.Add(time.Hour), want: logged.Add(123456789)},
+		{name: "no start", duration: 200 * time.Millisecond, readAt: logged, want: logged.Add(-200 * time.Millisecond)},
+		{name: "CLF placed within its second", startUTC: clf, duration: 100 * time.Millisecond, readAt: logged.Add(400 * time.Millisecond), want: logged.Add(300 * time.Millisecond)},
+		{name: "CLF read a little late", startUTC: clf, duration: 100 * time.Millisecond, readAt: logged.Add(1500 * time.Millisecond), want: logged.Add(time.Second - time.Nanosecond)},
+		{name: "CLF read early", startUTC: clf, duration: time.Second, readAt: logged.Add(500 * time.Millisecond), want: logged},
+		{name: "CLF backlog keeps the logged second", startUTC: clf, duration: 100 * time.Millisecond, readAt: logged.Add(time.Hour), want: logged},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := requestStart(&traefikLogConfig{StartUTC: tt.startUTC}, tt.duration, tt.readAt)
+			if !got.Equal(tt.want) {
+				t.Errorf("requestStart() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCLFConcurrencyPeak(t *testing.T) {
+	// Ten sequential 50ms requests logged in the same second
+	logged := time.Date(2024, 5, 1, 10, 0, 7, 0, time.UTC)
+	entry := &traefikLogConfig{StartUTC: logged.Format(clfTimeLayout), Duration: 50}
+	duration := 50 * time.Millisecond
+	ring := &intervalRing{}
+	for i := 1; i <= 10; i++ {
+		start := requestStart(entry, duration, logged.Add(time.Duration(i)*90*time.Millisecond))
+		ring.add(requestInterval{start: start.UnixNano(), end: start.Add(duration).UnixNano()}, 10)
+	}
+	if got := ring.estimate(logged.UnixNano(), logged.Add(time.Second).UnixNano()); got.Peak != 1 {
+		t.Errorf("peak = %d, want 1", got.Peak)
+	}
+}
@@ -5,46 +5,210 @@ import (
 	"fmt"
 	logger "github.com/sirupsen/logrus"
 	"io"
+	"net/url"
 	"os"
 	"regexp"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var (
 	// ... existing variables ...
-	topNPaths          int
 	topPathsMutex      sync.RWMutex
 	topPathsPerService = make(map[string]map[string]bool) // Tracks which paths are in the top N
+
+	officerConfig = &configStore{overlays: make(map[string]ServiceConfig)}
 )
 
 type TraefikService struct {
 	Name      string `json:"Name"`
 	Namespace string `json:"Namespace"`
+	Provider  string `json:"Provider"`
 }
 
 type TraefikOfficerConfig struct {
-	IgnoredRouters           []string         `json:"IgnoredRouters"`
-	IgnoredPathsRegex        []string         `json:"IgnoredPathsRegex"`
-	MergePathsWithExtensions []string         `json:"MergePathsWithExtensions"`
-	URLPatterns              []URLPattern     `json:"URLPatterns"`
-	AllowedServices          []TraefikService `json:"AllowedServices"`
-	TopNPaths                int              `json:"TopNPaths"`
-	Debug                    bool             `json:"Debug"`
+	IgnoredRouters           []string               `json:"IgnoredRouters"`
+	IgnoredPathsRegex        []string               `json:"IgnoredPathsRegex"`
+	MergePathsWithExtensions []string               `json:"MergePathsWithExtensions"`
+	URLPatterns              []URLPattern           `json:"URLPatterns"`
+	AllowedServices          []TraefikService       `json:"AllowedServices"`
+	EntryPoints              []string               `json:"EntryPoints"`
+	TopNPaths                int                    `json:"TopNPaths"`
+	TopNRanking              []string               `json:"TopNRanking"`
+	StatsWindows             []string               `json:"StatsWindows"`
+	SeriesTTL                string                 `json:"SeriesTTL"`
+	Quantiles                []float64              `json:"Quantiles"`
+	TopNMinRequests          int                    `json:"TopNMinRequests"`
+	MaxEndpointsPerService   int                    `json:"MaxEndpointsPerService"`
+	Buckets                  []float64              `json:"Buckets"`
+	NativeHistograms         NativeHistogramsConfig `json:"NativeHistograms"`
+	ApdexThreshold           string                 `json:"ApdexThreshold"`
+	BackendMetrics           BackendMetricsConfig   `json:"BackendMetrics"`
+	Concurrency              ConcurrencyConfig      `json:"Concurrency"`
+	TopTalkers               TopTalkersConfig       `json:"TopTalkers"`
+	Services                 []ServiceConfig        `json:"Services"`
+	SLOs                     []SLOConfig            `json:"SLOs"`
+	WorkloadMetadata         WorkloadMetadataConfig `json:"WorkloadMetadata"`
+	TemplateLearning         TemplateLearningConfig `json:"TemplateLearning"`
+	Debug                    bool                   `json:"Debug"`
+
+	ignoredPaths   []*regexp.Regexp
+	serviceIndex   map[string]*ServiceConfig
+	statsWindows   []statsWindow
+	slosByService  map[string][]*SLOConfig
+	apdexThreshold float64
+}
+
+// ServiceConfig holds settings that override the global ones for a single service.
+// They come from the Services list of the config file and from TraefikOfficer resources.
+type ServiceConfig struct {
+	Namespace         string       `json:"Namespace"`
+	Name              string       `json:"Name"`
+	URLPatterns       []URLPattern `json:"URLPatterns"`
+	TopNPaths         int          `json:"TopNPaths"`
+	TopNRanking       []string     `json:"TopNRanking"`
+	MaxEndpoints      int          `json:"MaxEndpoints"`
+	Buckets           []float64    `json:"Buckets"`
+	IgnoredPathsRegex []string     `json:"IgnoredPathsRegex"`
+	OpenAPISpec       string       `json:"OpenAPISpec"` // file path or http(s) URL of an OpenAPI 3 document
+
+	// EndpointBuckets overrides Buckets for single endpoints, keyed by the reported request path
+	EndpointBuckets map[string][]float64 `json:"EndpointBuckets"`
+	// ApdexThreshold is the Apdex T of the service, EndpointApdexThresholds overrides it per endpoint
+	ApdexThreshold          string            `json:"ApdexThreshold"`
+	EndpointApdexThresholds map[string]string `json:"EndpointApdexThresholds"`
+
+	ignoredPaths []*regexp.Regexp
+	openAPI      *openAPISource
+	apdex        apdexThresholds
+}
+
+// Key returns the namespace-name key the service is identified by in metrics
+func (sc *ServiceConfig) Key() string {
+	return BuildServiceName(normalizeTraefikName(sc.Namespace), normalizeTraefikName(sc.Name), "-")
+}
+
+// ServiceName returns the namespace/name of the configured service
+func (sc *ServiceConfig) ServiceName() string {
+	return sc.Namespace + "/" + sc.Name
+}
+
+// merge overlays the non-empty settings of other onto the service config.
+// URL patterns of other come first so they take precedence.
+func (sc *ServiceConfig) merge(other ServiceConfig) {
+	sc.URLPatterns = append(append([]URLPattern{}, other.URLPatterns...), sc.URLPatterns...)
+	sc.IgnoredPathsRegex = append(append([]string{}, sc.IgnoredPathsRegex...), other.IgnoredPathsRegex...)
+	if other.TopNPaths > 0 {
+		sc.TopNPaths = other.TopNPaths
+	}
+	if len(other.TopNRanking) > 0 {
+		sc.TopNRanking = other.TopNRanking
+	}
+	if other.MaxEndpoints > 0 {
+		sc.MaxEndpoints = other.MaxEndpoints
+	}
+	if len(other.Buckets) > 0 {
+		sc.Buckets = other.Buckets
+	}
+	if len(other.EndpointBuckets) > 0 {
+		endpointBuckets := make(map[string][]float64, len(sc.EndpointBuckets)+len(other.EndpointBuckets))
+		for endpoint, buckets := range sc.EndpointBuckets {
+			endpointBuckets[endpoint] = buckets
+		}
+		for endpoint, buckets := range other.EndpointBuckets {
+			endpointBuckets[endpoint] = buckets
+		}
+		sc.EndpointBuckets = endpointBuckets
+	}
+	if other.OpenAPISpec != "" {
+		sc.OpenAPISpec = other.OpenAPISpec
+	}
+	if other.ApdexThreshold != "" {
+		sc.ApdexThreshold = other.ApdexThreshold
+	}
+	if len(other.EndpointApdexThresholds) > 0 {
+		thresholds := make(map[string]string, len(sc.EndpointApdexThresholds)+len(other.EndpointApdexThresholds))
+		for endpoint, threshold := range sc.EndpointApdexThresholds {
+			thresholds[endpoint] = threshold
+		}
+		for endpoint, threshold := range other.EndpointApdexThresholds {
+			thresholds[endpoint] = threshold
+		}
+		sc.EndpointApdexThresholds = thresholds
+	}
 }
 
 type traefikLogConfig struct {
-	ClientHost        string  `json:"ClientHost"`
-	StartUTC          string  `json:"StartUTC"`
-	RouterName        string  `json:"RouterName"`
-	RequestMethod     string  `json:"RequestMethod"`
-	RequestPath       string  `json:"RequestPath"`
-	RequestProtocol   string  `json:"RequestProtocol"`
-	OriginStatus      int     `json:"OriginStatus"`
-	OriginContentSize int     `json:"OriginContentSize"`
-	RequestCount      int     `json:"RequestCount"`
-	Duration          float64 `json:"Duration"`
-	Overhead          float64 `json:"Overhead"`
+	ClientHost         string     `json:"ClientHost"`
+	StartUTC           string     `json:"StartUTC"`
+	RouterName         string     `json:"RouterName"`
+	RequestMethod      string     `json:"RequestMethod"`
+	RequestPath        string     `json:"RequestPath"`
+	RequestProtocol    string     `json:"RequestProtocol"`
+	OriginStatus       int        `json:"OriginStatus"`     // 0 in JSON logs if no backend responded
+	DownstreamStatus   int        `json:"DownstreamStatus"` // JSON logs only
+	OriginContentSize  int        `json:"OriginContentSize"`
+	RequestContentSize *int       `json:"RequestContentSize"` // JSON logs only
+	RequestCount       int        `json:"RequestCount"`
+	Duration           float64    `json:"Duration"`
+	Overhead           float64    `json:"Overhead"`                // JSON logs only
+	OriginDuration     float64    `json:"OriginDuration"`          // JSON logs only
+	ServiceURL         backendURL `json:"ServiceURL"`              // backend URL, "-" in CLF logs if none was selected
+	ServiceAddr        string     `json:"ServiceAddr"`             // backend host:port, JSON logs only
+	ForwardedFor       string     `json:"request_X-Forwarded-For"` // JSON logs keeping the header only
+	RetryAttempts      int        `json:"RetryAttempts"`           // JSON logs only
+
+	Router RouterInfo `json:"-"`
+	// fromJSON is set for JSON logs, which carry the fields CLF logs lack
+	fromJSON bool
+}
+
+// backendURL is the URL of the backend that served a request. Traefik writes
+// it as a string in CLF logs and as a serialized url.URL object in JSON logs.
+type backendURL string
+
+func (u *backendURL) UnmarshalJSON(data []byte) error {
+	if data[0] == '"' {
+		var raw string
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+		*u = backendURL(raw)
+		return nil
+	}
+
+	var parts struct {
+		Scheme string
+		Host   string
+		Path   string
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return err
+	}
+	*u = ""
+	if parts.Host != "" {
+		*u = backendURL((&url.URL{Scheme: parts.Scheme, Host: parts.Host, Path: parts.Path}).String())
+	}
+	return nil
+}
+
+// selected tells whether Traefik picked a backend for the request
+func (u backendURL) selected() bool {
+	return u != "" && u != "-"
+}
+
+// Host returns the host:port of the backend, or an empty string if none was selected
+func (u backendURL) Host() string {
+	if !u.selected() {
+		return ""
+	}
+	parsed, err := url.Parse(string(u))
+	if err != nil {
+		return ""
+	}
+	return parsed.Host
 }
 
 func LoadConfig(configLocation string) (TraefikOfficerConfig, error) {
@@ -91,25 +255,290 @@ func LoadConfig(configLocation string) (TraefikOfficerConfig, error) {
 	if config.URLPatterns == nil {
 		config.URLPatterns = []URLPattern{}
 	}
+	logger.Debugf("TopNPaths: %d", config.TopNPaths)
+
+	return config, nil
+}
 
-	if config.TopNPaths == 0 {
-		config.TopNPaths = 20
+// compile applies defaults, folds the per-service URL patterns into the global
+// list and compiles all regular expressions
+func (c *TraefikOfficerConfig) compile() {
+	if c.TopNPaths == 0 {
+		c.TopNPaths = 20
+	}
+	if c.MaxEndpointsPerService == 0 {
+		c.MaxEndpointsPerService = defaultMaxEndpointsPerService
+	}
+	if c.TopNMinRequests == 0 {
+		c.TopNMinRequests = defaultTopNMinRequests
+	}
+	c.TopNRanking = compileRankingCriteria("TopNRanking", c.TopNRanking)
+	c.statsWindows = compileStatsWindows(c.StatsWindows)
+	c.Quantiles = compileQuantiles(c.Quantiles)
+	c.Buckets = compileBuckets("Buckets", c.Buckets)
+	c.NativeHistograms.compile()
+	c.TopTalkers.compile()
+	c.SLOs, c.slosByService = compileSLOs(c.SLOs)
+	c.apdexThreshold = compileApdexThreshold("ApdexThreshold", c.ApdexThreshold, defaultApdexThreshold.Seconds())
+	if len(c.TopNRanking) == 0 {
+		c.TopNRanking = []string{rankByAvgLatency}
 	}
-	logger.Debugf("TopNPaths: %d", config.TopNPaths)
+
+	c.ignoredPaths = compileRegexList(c.IgnoredPathsRegex)
+
+	patterns := make([]URLPattern, 0, len(c.URLPatterns))
+	c.serviceIndex = make(map[string]*ServiceConfig, len(c.Services))
+	for i := range c.Services {
+		svc := &c.Services[i]
+		for _, pattern := range svc.URLPatterns {
+			pattern.Namespace, pattern.ServiceName = svc.Namespace, svc.Name
+			patterns = append(patterns, pattern)
+		}
+		svc.ignoredPaths = compileRegexList(svc.IgnoredPathsRegex)
+		svc.TopNRanking = compileRankingCriteria("TopNRanking of "+svc.ServiceName(), svc.TopNRanking)
+		svc.Buckets = compileBuckets("Buckets of "+svc.ServiceName(), svc.Buckets)
+		endpointBuckets := make(map[string][]float64, len(svc.EndpointBuckets))
+		for endpoint, buckets := range svc.EndpointBuckets {
+			endpointBuckets[endpoint] = compileBuckets("EndpointBuckets of "+svc.ServiceName()+" "+endpoint, buckets)
+		}
+		svc.EndpointBuckets = endpointBuckets
+		svc.compileApdex(c.apdexThreshold)
+		if svc.OpenAPISpec != "" {
+			svc.openAPI = openAPISpecs.Get(svc.OpenAPISpec)
+		}
+		c.serviceIndex[svc.Key()] = svc
+	}
+	c.URLPatterns = append(patterns, c.URLPatterns...)
 
 	// Compile regex patterns
-	for i := range config.URLPatterns {
-		regex, err := regexp.Compile(config.URLPatterns[i].Pattern)
+	for i := range c.URLPatterns {
+		regex, err := regexp.Compile(c.URLPatterns[i].Pattern)
 		if err != nil {
-			logger.Warnf("Invalid regex pattern for %s: %v - pattern will be ignored", config.URLPatterns[i].Replacement, err)
+			logger.Warnf("Invalid regex pattern for %s: %v - pattern will be ignored", c.URLPatterns[i].Replacement, err)
 			continue
 		}
-		config.URLPatterns[i].Regex = regex
+		c.URLPatterns[i].Regex = regex
 	}
+}
 
-	topNPaths = config.TopNPaths
+func compileStatsWindows(windows []string) []statsWindow {
+	if len(windows) == 0 {
+		windows = defaultStatsWindows
+	}
+	compiled := make([]statsWindow, 0, len(windows))
+	for _, label := range windows {
+		length, err := time.ParseDuration(label)
+		if err != nil || length < windowSlots*time.Second {
+			logger.Warnf("Invalid StatsWindows entry '%s' - it needs to be a duration of at least %ds and will be ignored", label, windowSlots)
+			continue
+		}
+		compiled = append(compiled, statsWindow{label: label, length: length})
+	}
+	return compiled
+}
 
-	return config, nil
+func compileQuantiles(quantiles []float64) []float64 {
+	if len(quantiles) == 0 {
+		return defaultQuantiles
+	}
+	valid := make([]float64, 0, len(quantiles))
+	for _, q := range quantiles {
+		if q <= 0 || q >= 1 {
+			logger.Warnf("Invalid Quantiles entry %v - it needs to be between 0 and 1 and will be ignored", q)
+			continue
+		}
+		valid = append(valid, q)
+	}
+	return valid
+}
+
+func compileRankingCriteria(setting string, criteria []string) []string {
+	valid, unknown := validRankingCriteria(criteria)
+	if len(unknown) > 0 {
+		logger.Warnf("Unknown %s criteria %v - they will be ignored", setting, unknown)
+	}
+	return valid
+}
+
+func compileRegexList(expressions []string) []*regexp.Regexp {
+	compiled := make([]*regexp.Regexp, 0, len(expressions))
+	for _, expr := range expressions {
+		regex, err := regexp.Compile(expr)
+		if err != nil {
+			logger.Warnf("Invalid regex '%s': %v - it will be ignored", expr, err)
+			continue
+		}
+		compiled = append(compiled, regex)
+	}
+	return compiled
+}
+
+// Service returns the overrides for a service key, or nil if there are none
+func (c *TraefikOfficerConfig) Service(service string) *ServiceConfig {
+	return c.serviceIndex[service]
+}
+
+// TopNFor returns how many paths of the service are exported individually
+func (c *TraefikOfficerConfig) TopNFor(service string) int {
+	if svc := c.Service(service); svc != nil && svc.TopNPaths > 0 {
+		return svc.TopNPaths
+	}
+	return c.TopNPaths
+}
+
+// SeriesIdleTTL returns how long a series may go without updates before it is
+// deleted, or zero if series never expire
+func (c *TraefikOfficerConfig) SeriesIdleTTL() time.Duration {
+	if c.SeriesTTL == "" {
+		return defaultSeriesTTL
+	}
+	ttl, err := time.ParseDuration(c.SeriesTTL)
+	if err != nil {
+		logger.Warnf("Invalid SeriesTTL '%s': %v - using %s", c.SeriesTTL, err, defaultSeriesTTL)
+		return defaultSeriesTTL
+	}
+	return ttl
+}
+
+// Windows returns the windows endpoint statistics are exported over
+func (c *TraefikOfficerConfig) Windows() []statsWindow {
+	return c.statsWindows
+}
+
+// TopNRankingFor returns the criteria the service's top paths are chosen by
+func (c *TraefikOfficerConfig) TopNRankingFor(service string) []string {
+	if svc := c.Service(service); svc != nil && len(svc.TopNRanking) > 0 {
+		return svc.TopNRanking
+	}
+	return c.TopNRanking
+}
+
+// MaxEndpointsFor returns the budget of distinct endpoints of the service
+func (c *TraefikOfficerConfig) MaxEndpointsFor(service string) int {
+	if svc := c.Service(service); svc != nil && svc.MaxEndpoints > 0 {
+		return svc.MaxEndpoints
+	}
+	return c.MaxEndpointsPerService
+}
+
+// IsPathIgnored reports whether the request path matches a global or per-service ignore rule
+func (c *TraefikOfficerConfig) IsPathIgnored(service, path string) bool {
+	for _, regex := range c.ignoredPaths {
+		if regex.MatchString(path) {
+			return true
+		}
+	}
+	if svc := c.Service(service); svc != nil {
+		for _, regex := range svc.ignoredPaths {
+			if regex.MatchString(path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// configStore holds the configuration loaded from file and the per-service
+// overlays from TraefikOfficer resources, and publishes their merge
+type configStore struct {
+	mu       sync.Mutex
+	base     TraefikOfficerConfig
+	overlays map[string]ServiceConfig // keyed by the resource they came from
+	current  atomic.Value             // *TraefikOfficerConfig
+	// overlaysAllow lets overlays opt their service in, bypassing AllowedServices
+	overlaysAllow bool
+}
+
+// CurrentConfig returns the effective configuration. It must not be modified.
+func CurrentConfig() *TraefikOfficerConfig {
+	if cfg, ok := officerConfig.current.Load().(*TraefikOfficerConfig); ok {
+		return cfg
+	}
+	cfg := &TraefikOfficerConfig{}
+	cfg.compile()
+	return cfg
+}
+
+// SetBase replaces the configuration loaded from file
+func (cs *configStore) SetBase(config TraefikOfficerConfig) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.base = config
+	cs.rebuild()
+}
+
+// SetOverlays replaces all per-service overlays. If allow is set, the services
+// they configure are allowed in addition to AllowedServices.
+func (cs *configStore) SetOverlays(overlays map[string]ServiceConfig, allow bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.overlays = overlays
+	cs.overlaysAllow = allow
+	cs.rebuild()
+}
+
+// rebuild merges base and overlays into a new effective config. The caller must hold mu.
+func (cs *configStore) rebuild() {
+	cfg := cs.base
+	cfg.URLPatterns = append([]URLPattern{}, cs.base.URLPatterns...)
+	cfg.Services = make([]ServiceConfig, 0, len(cs.base.Services)+len(cs.overlays))
+
+	index := make(map[string]int)
+	for _, svc := range cs.base.Services {
+		if i, exists := index[svc.Key()]; exists {
+			cfg.Services[i].merge(svc)
+			continue
+		}
+		index[svc.Key()] = len(cfg.Services)
+		cfg.Services = append(cfg.Services, svc)
+	}
+
+	sources := make([]string, 0, len(cs.overlays))
+	for source := range cs.overlays {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		overlay := cs.overlays[source]
+		if i, exists := index[overlay.Key()]; exists {
+			cfg.Services[i].merge(overlay)
+			continue
+		}
+		index[overlay.Key()] = len(cfg.Services)
+		cfg.Services = append(cfg.Services, overlay)
+	}
+
+	// Configuring a service in the config file opts it in. Overlays only do so
+	// if the operator allowed it, so the allowlist stays with the config file.
+	cfg.AllowedServices = append([]TraefikService{}, cs.base.AllowedServices...)
+	for _, svc := range cs.base.Services {
+		cfg.AllowedServices = append(cfg.AllowedServices, TraefikService{Namespace: svc.Namespace, Name: svc.Name})
+	}
+	if cs.overlaysAllow {
+		for _, overlay := range cs.overlays {
+			cfg.AllowedServices = append(cfg.AllowedServices, TraefikService{Namespace: overlay.Namespace, Name: overlay.Name})
+		}
+	}
+
+	cfg.compile()
+	cs.current.Store(&cfg)
+
+	// Specs dropped from the config file and resources stop being polled
+	specs := make(map[string]bool)
+	for _, svc := range cfg.Services {
+		if svc.OpenAPISpec != "" {
+			specs[svc.OpenAPISpec] = true
+		}
+	}
+	openAPISpecs.Retain(specs)
+
+	// Services named in config tell the router name parser where namespaces end
+	knownServices := append([]TraefikService{}, cfg.AllowedServices...)
+	for _, pattern := range cfg.URLPatterns {
+		knownServices = append(knownServices, TraefikService{Namespace: pattern.Namespace, Name: pattern.ServiceName})
+	}
+	routerNames.SetKnownServices("config", knownServices)
+	routerNames.SetEntryPoints(cfg.EntryPoints)
 }
 
 type LogSource interface {
@@ -119,7 +548,8 @@ type LogSource interface {
 
 // LogLine represents a single log line with metadata
 type LogLine struct {
-	Text string
-	Time time.Time
-	Err  error
+	Text   string
+	Time   time.Time
+	Source string // Traefik instance the line came from (pod name or file path)
+	Err    error
 }
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	logger "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	officerConditionReady = "Ready"
+
+	officerReasonValid    = "Valid"
+	officerReasonInvalid  = "InvalidSpec"
+	officerReasonConflict = "Conflict"
+)
+
+// officerResource is the TraefikOfficer custom resource, see deploy/traefikofficer-crd.yaml
+var officerResource = schema.GroupVersionResource{
+	Group:    "traefik-officer.io",
+	Version:  "v1alpha1",
+	Resource: "traefikofficers",
+}
+
+// OfficerResourceSpec is the spec of a TraefikOfficer resource. It configures
+// the service with the selected name in the resource's own namespace.
+type OfficerResourceSpec struct {
+	ServiceSelector struct {
+		Name string `json:"name"`
+	} `json:"serviceSelector"`
+	URLPatterns []struct {
+		Pattern     string `json:"pattern"`
+		Replacement string `json:"replacement"`
+	} `json:"urlPatterns,omitempty"`
+	TopN            int                  `json:"topN,omitempty"`
+	Buckets         []float64            `json:"buckets,omitempty"`
+	EndpointBuckets map[string][]float64 `json:"endpointBuckets,omitempty"`
+	IgnoredPaths    []string             `json:"ignoredPaths,omitempty"`
+}
+
+// OfficerResourceStatus is the status of a TraefikOfficer resource
+type OfficerResourceStatus struct {
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// officerResourceWatcher merges TraefikOfficer resources into the effective config
+type officerResourceWatcher struct {
+	informers     *KubernetesInformers
+	store         cache.Store
+	allowServices bool // resources opt their service in
+}
+
+// WatchOfficerResources registers an informer for TraefikOfficer resources. If
+// allowServices is set, the services they configure are allowed too.
+func WatchOfficerResources(ki *KubernetesInformers, allowServices bool) {
+	if !ki.HasResource(officerResource) {
+		logger.Warnf("Resource %s is not served, install deploy/traefikofficer-crd.yaml to use it", officerResource.String())
+		return
+	}
+
+	informer := ki.DynamicFactory.ForResource(officerResource).Informer()
+	watcher := &officerResourceWatcher{informers: ki, store: informer.GetStore(), allowServices: allowServices}
+	reconcile := func(interface{}) { watcher.reconcile() }
+	if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    reconcile,
+		UpdateFunc: func(_, newObj interface{}) { reconcile(newObj) },
+		DeleteFunc: reconcile,
+	}); err != nil {
+		logger.Warnf("Failed to watch %s: %v", officerResource.String(), err)
+		return
+	}
+	logger.Infof("Watching %s for per-service configuration", officerResource.String())
+}
+
+// reconcile validates all resources, publishes the valid ones as config overlays
+// and records the outcome in each resource's status. The oldest resource wins
+// when several select the same service.
+func (w *officerResourceWatcher) reconcile() {
+	resources := make([]*unstructured.Unstructured, 0)
+	for _, obj := range w.store.List() {
+		if resource, ok := obj.(*unstructured.Unstructured); ok {
+			resources = append(resources, resource)
+		}
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		ti, tj := resources[i].GetCreationTimestamp(), resources[j].GetCreationTimestamp()
+		if !ti.Equal(&tj) {
+			return ti.Before(&tj)
+		}
+		return resources[i].GetNamespace()+"/"+resources[i].GetName() < resources[j].GetNamespace()+"/"+resources[j].GetName()
+	})
+
+	overlays := make(map[string]ServiceConfig)
+	owners := make(map[string]string)
+	for _, resource := range resources {
+		source := resource.GetNamespace() + "/" + resource.GetName()
+		condition := metav1.Condition{
+			Type:               officerConditionReady,
+			Status:             metav1.ConditionTrue,
+			Reason:             officerReasonValid,
+			Message:            "Configuration applied",
+			ObservedGeneration: resource.GetGeneration(),
+		}
+
+		svc, err := officerResourceServiceConfig(resource)
+		if err != nil {
+			condition.Status, condition.Reason, condition.Message = metav1.ConditionFalse, officerReasonInvalid, err.Error()
+			logger.Warnf("Invalid TraefikOfficer %s: %v", source, err)
+		} else if owner, taken := owners[svc.Key()]; taken {
+			condition.Status, condition.Reason = metav1.ConditionFalse, officerReasonConflict
+			condition.Message = fmt.Sprintf("Service %s is already configured by %s", svc.ServiceName(), owner)
+		} else {
+			owners[svc.Key()] = source
+			overlays[source] = svc
+		}
+
+		w.updateStatus(resource, condition)
+	}
+
+	officerConfig.SetOverlays(overlays, w.allowServices)
+}
+
+// officerResourceServiceConfig validates a resource and converts it to a service config
+func officerResourceServiceConfig(resource *unstructured.Unstructured) (ServiceConfig, error) {
+	var spec OfficerResourceSpec
+	rawSpec, _, _ := unstructured.NestedMap(resource.Object, "spec")
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(rawSpec, &spec); err != nil {
+		return ServiceConfig{}, fmt.Errorf("invalid spec: %w", err)
+	}
+
+	var problems []string
+	if spec.ServiceSelector.Name == "" {
+		problems = append(problems, "serviceSelector.name is required")
+	}
+	if spec.TopN < 0 {
+		problems = append(problems, "topN must not be negative")
+	}
+	if err := validateBuckets(spec.Buckets); err != nil {
+		problems = append(problems, fmt.Sprintf("buckets: %v", err))
+	}
+	for endpoint, buckets := range spec.EndpointBuckets {
+		if err := validateBuckets(buckets); err != nil {
+			problems = append(problems, fmt.Sprintf("endpointBuckets[%s]: %v", endpoint, err))
+		}
+	}
+	svc := ServiceConfig{
+		Namespace:         resource.GetNamespace(),
+		Name:              spec.ServiceSelector.Name,
+		TopNPaths:         spec.TopN,
+		Buckets:           spec.Buckets,
+		EndpointBuckets:   spec.EndpointBuckets,
+		IgnoredPathsRegex: spec.IgnoredPaths,
+	}
+	for i, pattern := range spec.URLPatterns {
+		if _, err := regexp.Compile(pattern.Pattern); err != nil {
+			problems = append(problems, fmt.Sprintf("urlPatterns[%d].pattern: %v", i, err))
+		}
+		if pattern.Replacement == "" {
+			problems = append(problems, fmt.Sprintf("urlPatterns[%d].replacement is required", i))
+		}
+		svc.URLPatterns = append(svc.URLPatterns, URLPattern{Pattern: pattern.Pattern, Replacement: pattern.Replacement})
+	}
+	for i, expr := range spec.IgnoredPaths {
+		if _, err := regexp.Compile(expr); err != nil {
+			problems = append(problems, fmt.Sprintf("ignoredPaths[%d]: %v", i, err))
+		}
+	}
+
+	if len(problems) > 0 {
+		return ServiceConfig{}, fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return svc, nil
+}
+
+// updateStatus sets the condition on the resource, skipping the API call when nothing changed
+func (w *officerResourceWatcher) updateStatus(resource *unstructured.Unstructured, condition metav1.Condition) {
+	var status OfficerResourceStatus
+	if rawStatus, found, _ := unstructured.NestedMap(resource.Object, "status"); found {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(rawStatus, &status); err != nil {
+			logger.Debugf("Ignoring unreadable status of %s/%s: %v", resource.GetNamespace(), resource.GetName(), err)
+		}
+	}
+
+	if existing := meta.FindStatusCondition(status.Conditions, condition.Type); existing != nil &&
+		existing.Status == condition.Status && existing.Reason == condition.Reason &&
+		existing.Message == condition.Message && existing.ObservedGeneration == condition.ObservedGeneration {
+		return
+	}
+	meta.SetStatusCondition(&status.Conditions, condition)
+
+	rawStatus, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		logger.Warnf("Failed to encode status of %s/%s: %v", resource.GetNamespace(), resource.GetName(), err)
+		return
+	}
+	updated := resource.DeepCopy()
+	if err := unstructured.SetNestedMap(updated.Object, rawStatus, "status"); err != nil {
+		logger.Warnf("Failed to set status of %s/%s: %v", resource.GetNamespace(), resource.GetName(), err)
+		return
+	}
+
+	_, err = w.informers.Dynamic.Resource(officerResource).Namespace(resource.GetNamespace()).
+		UpdateStatus(context.Background(), updated, metav1.UpdateOptions{})
+	if err != nil {
+		logger.Warnf("Failed to update status of %s/%s: %v", resource.GetNamespace(), resource.GetName(), err)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func officerResourceObject(namespace, name string, created time.Time, spec map[string]interface{}) *unstructured.Unstructured {
+	resource := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "traefik-officer.io/v1alpha1",
+		"kind":       "TraefikOfficer",
+		"spec":       spec,
+	}}
+	resource.SetNamespace(namespace)
+	resource.SetName(name)
+	resource.SetGeneration(1)
+	resource.SetCreationTimestamp(metav1.NewTime(created))
+	return resource
+}
+
+func TestOfficerResourceServiceConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    map[string]interface{}
+		wantErr string
+	}{
+		{
+			name: "valid",
+			spec: map[string]interface{}{
+				"serviceSelector": map[string]interface{}{"name": "store"},
+				"urlPatterns":     []interface{}{map[string]interface{}{"pattern": `/orders/\d+`, "replacement": "/orders/{id}"}},
+				"topN":            int64(10),
+				"buckets":         []interface{}{0.1, 0.5, 1.0},
+				"ignoredPaths":    []interface{}{"^/health$"},
+			},
+		},
+		{
+			name:    "missing service",
+			spec:    map[string]interface{}{"topN": int64(10)},
+			wantErr: "serviceSelector.name is required",
+		},
+		{
+			name:    "negative topN",
+			spec:    map[string]interface{}{"serviceSelector": map[string]interface{}{"name": "store"}, "topN": int64(-1)},
+			wantErr: "topN must not be negative",
+		},
+		{
+			name:    "unsorted buckets",
+			spec:    map[string]interface{}{"serviceSelector": map[string]interface{}{"name": "store"}, "buckets": []interface{}{1.0, 0.5}},
+			wantErr: "buckets:",
+		},
+		{
+			name: "invalid pattern and missing replacement",
+			spec: map[string]interface{}{
+				"serviceSelector": map[string]interface{}{"name": "store"},
+				"urlPatterns":     []interface{}{map[string]interface{}{"pattern": "/orders/(", "replacement": ""}},
+			},
+			wantErr: "urlPatterns[0].pattern: error parsing regexp: missing closing ): `/orders/(`; urlPatterns[0].replacement is required",
+		},
+		{
+			name:    "invalid ignored path",
+			spec:    map[string]interface{}{"serviceSelector": map[string]interface{}{"name": "store"}, "ignoredPaths": []interface{}{"["}},
+			wantErr: "ignoredPaths[0]:",
+		},
+		{
+			name:    "wrong type",
+			spec:    map[string]interface{}{"serviceSelector": map[string]interface{}{"name": "store"}, "topN": "ten"},
+			wantErr: "invalid spec",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, err := officerResourceServiceConfig(officerResourceObject("shop", "officer", time.Now(), tt.spec))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if svc.Namespace != "shop" || svc.Name != "store" || svc.TopNPaths != 10 || len(svc.URLPatterns) != 1 || len(svc.Buckets) != 3 {
+				t.Errorf("service config = %+v", svc)
+			}
+		})
+	}
+}
+
+// reconcileFakeOfficerResources reconciles the resources through a fake
+// dynamic client and returns it to read the status back
+func reconcileFakeOfficerResources(t *testing.T, allowServices bool, resources ...*unstructured.Unstructured) *dynamicfake.FakeDynamicClient {
+	t.Helper()
+
+	objects := make([]runtime.Object, 0, len(resources))
+	for _, resource := range resources {
+		objects = append(objects, resource)
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{officerResource: "TraefikOfficerList"}, objects...)
+	ki := NewKubernetesInformers(fake.NewSimpleClientset(), dynamicClient, "")
+	informer := ki.DynamicFactory.ForResource(officerResource).Informer()
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	if err := ki.Start(stopCh); err != nil {
+		t.Fatalf("starting informers: %v", err)
+	}
+
+	watcher := &officerResourceWatcher{informers: ki, store: informer.GetStore(), allowServices: allowServices}
+	watcher.reconcile()
+	return dynamicClient
+}
+
+func readyCondition(t *testing.T, client *dynamicfake.FakeDynamicClient, namespace, name string) *metav1.Condition {
+	t.Helper()
+	resource, err := client.Resource(officerResource).Namespace(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting %s/%s: %v", namespace, name, err)
+	}
+	var status OfficerResourceStatus
+	rawStatus, _, _ := unstructured.NestedMap(resource.Object, "status")
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(rawStatus, &status); err != nil {
+		t.Fatalf("reading status of %s/%s: %v", namespace, name, err)
+	}
+	return meta.FindStatusCondition(status.Conditions, officerConditionReady)
+}
+
+func TestOfficerResourceReconcile(t *testing.T) {
+	t.Cleanup(func() {
+		officerConfig.SetOverlays(map[string]ServiceConfig{}, false)
+		officerConfig.SetBase(TraefikOfficerConfig{})
+	})
+	officerConfig.SetBase(TraefikOfficerConfig{
+		TopNPaths: 20,
+		Services: []ServiceConfig{{
+			Namespace:   "shop",
+			Name:        "store",
+			TopNPaths:   5,
+			URLPatterns: []URLPattern{{Pattern: `/items/\d+`, Replacement: "/items/{id}"}},
+		}},
+	})
+
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	store := map[string]interface{}{
+		"serviceSelector": map[string]interface{}{"name": "store"},
+		"urlPatterns":     []interface{}{map[string]interface{}{"pattern": `/orders/\d+`, "replacement": "/orders/{id}"}},
+		"topN":            int64(10),
+	}
+	cart := map[string]interface{}{"serviceSelector": map[string]interface{}{"name": "cart"}, "topN": int64(3)}
+	client := reconcileFakeOfficerResources(t, false,
+		officerResourceObject("shop", "store-late", created.Add(time.Hour), store),
+		officerResourceObject("shop", "store-early", created, store),
+		officerResourceObject("shop", "cart-b", created, cart),
+		officerResourceObject("shop", "cart-a", created, cart),
+		officerResourceObject("shop", "broken", created, map[string]interface{}{"topN": int64(-1)}),
+	)
+
+	tests := []struct {
+		name       string
+		wantStatus metav1.ConditionStatus
+		wantReason string
+		wantOwner  string
+	}{
+		{name: "store-early", wantStatus: metav1.ConditionTrue, wantReason: officerReasonValid},
+		{name: "store-late", wantStatus: metav1.ConditionFalse, wantReason: officerReasonConflict, wantOwner: "shop/store-early"},
+		{name: "cart-a", wantStatus: metav1.ConditionTrue, wantReason: officerReasonValid},
+		{name: "cart-b", wantStatus: metav1.ConditionFalse, wantReason: officerReasonConflict, wantOwner: "shop/cart-a"},
+		{name: "broken", wantStatus: metav1.ConditionFalse, wantReason: officerReasonInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition := readyCondition(t, client, "shop", tt.name)
+			if condition == nil {
+				t.Fatal("no Ready condition")
+			}
+			if condition.Status != tt.wantStatus || condition.Reason != tt.wantReason || condition.ObservedGeneration != 1 {
+				t.Errorf("Ready = %s/%s (generation %d), want %s/%s", condition.Status, condition.Reason, condition.ObservedGeneration, tt.wantStatus, tt.wantReason)
+			}
+			if tt.wantOwner != "" && !strings.Contains(condition.Message, tt.wantOwner) {
+				t.Errorf("message %q does not name the owner %s", condition.Message, tt.wantOwner)
+			}
+		})
+	}
+
+	// The overlay takes precedence over the config file
+	config := CurrentConfig()
+	svc := config.Service(BuildServiceName("shop", "store", "-"))
+	if svc == nil {
+		t.Fatal("shop/store missing from the effective config")
+	}
+	if svc.TopNPaths != 10 || len(svc.URLPatterns) != 2 || svc.URLPatterns[0].Replacement != "/orders/{id}" {
+		t.Errorf("merged shop/store = TopNPaths %d, URLPatterns %+v", svc.TopNPaths, svc.URLPatterns)
+	}
+	if config.Service(BuildServiceName("shop", "cart", "-")) == nil {
+		t.Error("shop/cart overlay missing from the effective config")
+	}
+}
+
+func TestOfficerResourceAllowServices(t *testing.T) {
+	t.Cleanup(func() {
+		officerConfig.SetOverlays(map[string]ServiceConfig{}, false)
+		officerConfig.SetBase(TraefikOfficerConfig{})
+	})
+	officerConfig.SetBase(TraefikOfficerConfig{
+		AllowedServices: []TraefikService{{Namespace: "shop", Name: "store"}},
+	})
+	cart := officerResourceObject("shop", "cart", time.Now(), map[string]interface{}{"serviceSelector": map[string]interface{}{"name": "cart"}})
+
+	allowed := func() bool {
+		for _, svc := range CurrentConfig().AllowedServices {
+			if svc.Namespace == "shop" && svc.Name == "cart" {
+				return true
+			}
+		}
+		return false
+	}
+
+	reconcileFakeOfficerResources(t, false, cart.DeepCopy())
+	if allowed() {
+		t.Error("a TraefikOfficer resource opted its service in without --officer-resources-allow-services")
+	}
+	reconcileFakeOfficerResources(t, true, cart.DeepCopy())
+	if !allowed() {
+		t.Error("a TraefikOfficer resource did not opt its service in with --officer-resources-allow-services")
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	logger "github.com/sirupsen/logrus"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// discoveryEnabledAnnotation opts an IngressRoute or Ingress into metrics
+	discoveryEnabledAnnotation = "traefik-officer/enabled"
+
+	kindIngressRoute = "IngressRoute"
+	kindIngress      = "Ingress"
+)
+
+var (
+	// Both the current and the legacy Traefik CRD groups are watched
+	ingressRouteResources = []schema.GroupVersionResource{
+		{Group: "traefik.io", Version: "v1alpha1", Resource: "ingressroutes"},
+		{Group: "traefik.containo.us", Version: "v1alpha1", Resource: "ingressroutes"},
+	}
+
+	// Matchers in an IngressRoute rule whose arguments we keep as URL metadata
+	ruleMatcherRegex  = regexp.MustCompile("(HostSNI|Host|PathPrefix|Path)\\(([^)]*)\\)")
+	ruleArgumentRegex = regexp.MustCompile("[`\"]([^`\"]*)[`\"]")
+
+	discoveredServices = &serviceDiscovery{services: make(map[string]*DiscoveredService)}
+)
+
+// DiscoveredService is a service found from an IngressRoute or Ingress object
+type DiscoveredService struct {
+	Kind      string   `json:"kind"`
+	Namespace string   `json:"namespace"`
+	Name      string   `json:"name"`
+	Enabled   bool     `json:"enabled"`
+	Routers   []string `json:"routers"`
+	Hosts     []string `json:"hosts,omitempty"`
+	Paths     []string `json:"paths,omitempty"`
+	Backends  []string `json:"backends,omitempty"` // namespace/name of the Services routed to
+}
+
+// Provider returns the Traefik provider that generates routers for the object
+func (ds *DiscoveredService) Provider() string {
+	if ds.Kind == kindIngress {
+		return providerKubernetesIngress
+	}
+	return providerKubernetesCRD
+}
+
+// serviceDiscovery keeps the services discovered from Kubernetes objects and
+// publishes their router names to the router name parser
+type serviceDiscovery struct {
+	mu       sync.RWMutex
+	services map[string]*DiscoveredService // keyed by kind/namespace/name
+	enabled  map[string]bool               // provider/namespace-name of opted in services
+}
+
+// WatchIngressObjects registers informers for Ingress objects and, when the
+// CRDs are installed, Traefik IngressRoutes
+func WatchIngressObjects(ki *KubernetesInformers) {
+	ingressInformer := ki.Factory.Networking().V1().Ingresses().Informer()
+	if _, err := ingressInformer.AddEventHandler(discoveredServices.eventHandler(func(obj interface{}) *DiscoveredService {
+		ingress, ok := obj.(*networkingv1.Ingress)
+		if !ok {
+			return nil
+		}
+		return ingressService(ingress)
+	})); err != nil {
+		logger.Warnf("Failed to watch Ingress objects: %v", err)
+	}
+
+	for _, gvr := range ingressRouteResources {
+		if !ki.HasResource(gvr) {
+			logger.Debugf("Resource %s not served, not watching it", gvr.String())
+			continue
+		}
+		logger.Infof("Watching %s for service discovery", gvr.String())
+		informer := ki.DynamicFactory.ForResource(gvr).Informer()
+		if _, err := informer.AddEventHandler(discoveredServices.eventHandler(func(obj interface{}) *DiscoveredService {
+			route, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				return nil
+			}
+			return ingressRouteService(route)
+		})); err != nil {
+			logger.Warnf("Failed to watch %s: %v", gvr.String(), err)
+		}
+	}
+}
+
+// eventHandler returns informer callbacks that convert objects with toService
+func (sd *serviceDiscovery) eventHandler(toService func(obj interface{}) *DiscoveredService) cache.ResourceEventHandlerFuncs {
+	upsert := func(obj interface{}) {
+		if svc := toService(obj); svc != nil {
+			sd.upsert(svc)
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    upsert,
+		UpdateFunc: func(_, newObj interface{}) { upsert(newObj) },
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if svc := toService(obj); svc != nil {
+				sd.remove(svc)
+			}
+		},
+	}
+}
+
+func discoveryKey(svc *DiscoveredService) string {
+	return svc.Kind + "/" + svc.Namespace + "/" + svc.Name
+}
+
+func (sd *serviceDiscovery) upsert(svc *DiscoveredService) {
+	sd.mu.Lock()
+	sd.services[discoveryKey(svc)] = svc
+	sd.mu.Unlock()
+	logger.Debugf("Discovered %s %s/%s (enabled: %t, routers: %v)", svc.Kind, svc.Namespace, svc.Name, svc.Enabled, svc.Routers)
+	sd.publish()
+}
+
+func (sd *serviceDiscovery) remove(svc *DiscoveredService) {
+	sd.mu.Lock()
+	delete(sd.services, discoveryKey(svc))
+	sd.mu.Unlock()
+	logger.Debugf("Removed %s %s/%s", svc.Kind, svc.Namespace, svc.Name)
+	sd.publish()
+}
+
+// publish rebuilds the opted in set and hands names to the router name parser
+func (sd *serviceDiscovery) publish() {
+	sd.mu.Lock()
+	known := make([]TraefikService, 0, len(sd.services))
+	routers := make(map[string]RouterInfo)
+	enabled := make(map[string]bool)
+	for _, svc := range sd.services {
+		info := RouterInfo{
+			Provider:  svc.Provider(),
+			Namespace: normalizeTraefikName(svc.Namespace),
+			Resource:  normalizeTraefikName(svc.Name),
+		}
+		known = append(known, TraefikService{Namespace: svc.Namespace, Name: svc.Name, Provider: info.Provider})
+		for _, router := range svc.Routers {
+			routers[router] = info
+		}
+		if svc.Enabled {
+			enabled[info.Provider+"/"+info.ServiceKey()] = true
+		}
+	}
+	sd.enabled = enabled
+	sd.mu.Unlock()
+
+	routerNames.SetKnownServices("discovery", known)
+	routerNames.SetKnownRouters("discovery", routers)
+}
+
+// Allowed reports whether the router belongs to a discovered service that opted in
+func (sd *serviceDiscovery) Allowed(info RouterInfo) bool {
+	sd.mu.RLock()
+	defer sd.mu.RUnlock()
+	return sd.enabled[info.Provider+"/"+info.ServiceKey()]
+}
+
+// List returns a copy of all discovered services, sorted by namespace and name
+func (sd *serviceDiscovery) List() []DiscoveredService {
+	sd.mu.RLock()
+	list := make([]DiscoveredService, 0, len(sd.services))
+	for _, svc := range sd.services {
+		list = append(list, *svc)
+	}
+	sd.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return discoveryKey(&list[i]) < discoveryKey(&list[j])
+	})
+	return list
+}
+
+// Lookup returns the discovered service that generates the given router
+func (sd *serviceDiscovery) Lookup(info RouterInfo) (DiscoveredService, bool) {
+	sd.mu.RLock()
+	defer sd.mu.RUnlock()
+	for _, svc := range sd.services {
+		if svc.Provider() == info.Provider &&
+			normalizeTraefikName(svc.Namespace) == info.Namespace &&
+			normalizeTraefikName(svc.Name) == info.Resource {
+			return *svc, true
+		}
+	}
+	return DiscoveredService{}, false
+}
+
+// ingressRouteService maps an IngressRoute to its generated router names,
+// which Traefik builds as namespace-name-<first 10 bytes of sha256(match)>
+func ingressRouteService(route *unstructured.Unstructured) *DiscoveredService {
+	name := route.GetName()
+	if name == "" {
+		name = route.GetGenerateName()
+	}
+	svc := &DiscoveredService{
+		Kind:      kindIngressRoute,
+		Namespace: route.GetNamespace(),
+		Name:      name,
+		Enabled:   route.GetAnnotations()[discoveryEnabledAnnotation] == "true",
+	}
+
+	routes, _, err := unstructured.NestedSlice(route.Object, "spec", "routes")
+	if err != nil {
+		logger.Warnf("Invalid routes in IngressRoute %s/%s: %v", svc.Namespace, svc.Name, err)
+	}
+	for _, r := range routes {
+		spec, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		match, _ := spec["match"].(string)
+		hash := sha256.Sum256([]byte(match))
+		routerKey := fmt.Sprintf("%s-%s-%.10x", svc.Namespace, name, hash)
+		svc.Routers = appendUnique(svc.Routers, normalizeTraefikName(routerKey)+"@"+providerKubernetesCRD)
+
+		for _, m := range ruleMatcherRegex.FindAllStringSubmatch(match, -1) {
+			for _, arg := range ruleArgumentRegex.FindAllStringSubmatch(m[2], -1) {
+				if strings.HasPrefix(m[1], "Host") {
+					svc.Hosts = appendUnique(svc.Hosts, arg[1])
+				} else {
+					svc.Paths = appendUnique(svc.Paths, arg[1])
+				}
+			}
+		}
+
+		backends, _ := spec["services"].([]interface{})
+		for _, b := range backends {
+			backend, ok := b.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if kind, _ := backend["kind"].(string); kind != "" && kind != "Service" {
+				continue
+			}
+			backendName, _ := backend["name"].(string)
+			backendNamespace, _ := backend["namespace"].(string)
+			if backendNamespace == "" {
+				backendNamespace = svc.Namespace
+			}
+			if backendName != "" {
+				svc.Backends = appendUnique(svc.Backends, backendNamespace+"/"+backendName)
+			}
+		}
+	}
+	return svc
+}
+
+// ingressService maps an Ingress to its generated router names,
+// which Traefik builds as namespace-name-host-path
+func ingressService(ingress *networkingv1.Ingress) *DiscoveredService {
+	svc := &DiscoveredService{
+		Kind:      kindIngress,
+		Namespace: ingress.Namespace,
+		Name:      ingress.Name,
+		Enabled:   ingress.Annotations[discoveryEnabledAnnotation] == "true",
+	}
+
+	addBackend := func(backend networkingv1.IngressBackend) {
+		if backend.Service != nil && backend.Service.Name != "" {
+			svc.Backends = appendUnique(svc.Backends, ingress.Namespace+"/"+backend.Service.Name)
+		}
+	}
+	if ingress.Spec.DefaultBackend != nil {
+		addBackend(*ingress.Spec.DefaultBackend)
+	}
+
+	for _, rule := range ingress.Spec.Rules {
+		if rule.Host != "" {
+			svc.Hosts = appendUnique(svc.Hosts, rule.Host)
+		}
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			routerKey := normalizeTraefikName(ingress.Namespace + "-" + ingress.Name + "-" + rule.Host + path.Path)
+			svc.Routers = appendUnique(svc.Routers, routerKey+"@"+providerKubernetesIngress)
+			if path.Path != "" {
+				svc.Paths = appendUnique(svc.Paths, path.Path)
+			}
+			addBackend(path.Backend)
+		}
+	}
+	return svc
+}
+
+func appendUnique(list []string, item string) []string {
+	for _, existing := range list {
+		if existing == item {
+			return list
+		}
+	}
+	return append(list, item)
+}
+
+// DiscoveredServicesHandler serves the discovered services and their URL metadata
+func DiscoveredServicesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(discoveredServices.List())
+}
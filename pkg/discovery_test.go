@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// startFakeDiscovery watches the objects through fake clients with the
+// traefik.io IngressRoute CRD installed
+func startFakeDiscovery(t *testing.T, objects []runtime.Object, routes ...*unstructured.Unstructured) {
+	t.Helper()
+
+	discoveredServices = &serviceDiscovery{services: make(map[string]*DiscoveredService)}
+	routerNames = newRouterNameParser()
+
+	client := fake.NewSimpleClientset(objects...)
+	client.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{{
+		GroupVersion: "traefik.io/v1alpha1",
+		APIResources: []metav1.APIResource{{Name: "ingressroutes", Kind: kindIngressRoute}},
+	}}
+
+	dynamicObjects := make([]runtime.Object, 0, len(routes))
+	for _, route := range routes {
+		dynamicObjects = append(dynamicObjects, route)
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{ingressRouteResources[0]: "IngressRouteList", ingressRouteResources[1]: "IngressRouteList"},
+		dynamicObjects...)
+
+	ki := NewKubernetesInformers(client, dynamicClient, "")
+	WatchIngressObjects(ki)
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	if err := ki.Start(stopCh); err != nil {
+		t.Fatalf("starting informers: %v", err)
+	}
+
+	// Handlers are called after the caches sync
+	deadline := time.Now().Add(5 * time.Second)
+	for len(discoveredServices.List()) < len(objects)+len(routes) {
+		if time.Now().After(deadline) {
+			t.Fatalf("discovered %d objects, want %d", len(discoveredServices.List()), len(objects)+len(routes))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func ingressRoute(namespace, name string, annotations map[string]string, matches ...string) *unstructured.Unstructured {
+	routes := make([]interface{}, 0, len(matches))
+	for _, match := range matches {
+		routes = append(routes, map[string]interface{}{
+			"match":    match,
+			"services": []interface{}{map[string]interface{}{"name": name + "-svc", "port": int64(80)}},
+		})
+	}
+	route := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "traefik.io/v1alpha1",
+		"kind":       kindIngressRoute,
+		"spec":       map[string]interface{}{"routes": routes},
+	}}
+	route.SetNamespace(namespace)
+	route.SetName(name)
+	route.SetAnnotations(annotations)
+	return route
+}
+
+func TestServiceDiscoveryRouterNames(t *testing.T) {
+	pathType := networkingv1.PathTypePrefix
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "whoami",
+			Annotations: map[string]string{discoveryEnabledAnnotation: "true"},
+		},
+		Spec: networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{
+			Host: "whoami.example.com",
+			IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+				Paths: []networkingv1.HTTPIngressPath{{
+					Path:     "/api/v1",
+					PathType: &pathType,
+					Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+						Name: "whoami", Port: networkingv1.ServiceBackendPort{Number: 80},
+					}},
+				}},
+			}},
+		}}},
+	}
+	route := ingressRoute("shop", "store-front", map[string]string{discoveryEnabledAnnotation: "true"},
+		"Host(`shop.example.com`) && PathPrefix(`/api`)",
+		"Host(`shop.example.com`)")
+
+	startFakeDiscovery(t, []runtime.Object{ingress}, route)
+
+	// Router names as Traefik writes them to the access log
+	tests := []struct {
+		router    string
+		namespace string
+		resource  string
+	}{
+		{router: "shop-store-front-2e672463355d335d17ef@kubernetescrd", namespace: "shop", resource: "store-front"},
+		{router: "shop-store-front-38bcef08ab977d6de43a@kubernetescrd", namespace: "shop", resource: "store-front"},
+		{router: "default-whoami-whoami-example-com-api-v1@kubernetes", namespace: "default", resource: "whoami"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.router, func(t *testing.T) {
+			info := routerNames.Parse(tt.router)
+			if info.Namespace != tt.namespace || info.Resource != tt.resource {
+				t.Errorf("Parse(%q) = %q/%q, want %q/%q", tt.router, info.Namespace, info.Resource, tt.namespace, tt.resource)
+			}
+			if !discoveredServices.Allowed(info) {
+				t.Errorf("router %q of an enabled object is not allowed", tt.router)
+			}
+		})
+	}
+}
+
+func TestDiscoveredServicesHandler(t *testing.T) {
+	startFakeDiscovery(t, nil,
+		ingressRoute("shop", "store-front", nil, "Host(`shop.example.com`) && PathPrefix(`/api`)"))
+
+	recorder := httptest.NewRecorder()
+	DiscoveredServicesHandler(recorder, httptest.NewRequest("GET", "/services", nil))
+
+	var services []DiscoveredService
+	if err := json.NewDecoder(recorder.Body).Decode(&services); err != nil {
+		t.Fatalf("decoding /services: %v", err)
+	}
+	want := []DiscoveredService{{
+		Kind:      kindIngressRoute,
+		Namespace: "shop",
+		Name:      "store-front",
+		Routers:   []string{"shop-store-front-2e672463355d335d17ef@kubernetescrd"},
+		Hosts:     []string{"shop.example.com"},
+		Paths:     []string{"/api"},
+		Backends:  []string{"shop/store-front-svc"},
+	}}
+	if !reflect.DeepEqual(services, want) {
+		t.Errorf("/services = %+v, want %+v", services, want)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultSeriesTTL = time.Hour
+	// maxExpiryInterval caps how long an idle series outlives its TTL
+	maxExpiryInterval = time.Minute
+)
+
+var (
+	expiredSeries = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "traefik_officer_expired_series_total",
+			Help: "Series deleted because they received no updates for longer than SeriesTTL",
+		},
+		[]string{"metric"},
+	)
+
+	series = &seriesTracker{series: make(map[string]*trackedSeries)}
+)
+
+// deletableVec is a metric vector whose series can be deleted one by one
+type deletableVec interface {
+	DeleteLabelValues(lvs ...string) bool
+}
+
+type trackedSeries struct {
+	metric   string
+	vec      deletableVec
+	lvs      []string
+	lastSeen time.Time
+}
+
+// seriesTracker records when each series was last updated so idle ones can be deleted
+type seriesTracker struct {
+	mu     sync.Mutex
+	series map[string]*trackedSeries
+}
+
+// Touch marks the series of the vector as updated now
+func (st *seriesTracker) Touch(metric string, vec deletableVec, lvs ...string) {
+	key := metric + "\xff" + strings.Join(lvs, "\xff")
+	now := time.Now()
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if ts, exists := st.series[key]; exists {
+		ts.lastSeen = now
+		return
+	}
+	st.series[key] = &trackedSeries{metric: metric, vec: vec, lvs: append([]string{}, lvs...), lastSeen: now}
+}
+
+// Expire deletes the series last updated before cutoff
+func (st *seriesTracker) Expire(cutoff time.Time) int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	expired := 0
+	for key, ts := range st.series {
+		if ts.lastSeen.After(cutoff) {
+			continue
+		}
+		ts.vec.DeleteLabelValues(ts.lvs...)
+		delete(st.series, key)
+		expiredSeries.WithLabelValues(ts.metric).Inc()
+		expired++
+	}
+	return expired
+}
+
+// expireEndpointStats removes the stats of endpoints that saw no request since
+// cutoff and frees their place in the service's endpoint budget
+func expireEndpointStats(cutoff time.Time) int {
+	var expired []string
+
+	endpointStatsMutex.Lock()
+	for key, stat := range endpointStats {
+		stat.mu.Lock()
+		if stat.LastSeen.Before(cutoff) {
+			stat.retired = true
+			delete(endpointStats, key)
+			expired = append(expired, key)
+		}
+		stat.mu.Unlock()
+	}
+	endpointStatsMutex.Unlock()
+
+	for _, key := range expired {
+		if service, endpoint, ok := strings.Cut(key, ":"); ok {
+			endpointGuard.Forget(service, endpoint)
+		}
+	}
+	return len(expired)
+}
+
+// startSeriesExpiry periodically deletes series and endpoint stats idle for longer than ttl
+func startSeriesExpiry(ttl time.Duration) {
+	if ttl <= 0 {
+		logger.Info("Series expiry disabled")
+		return
+	}
+
+	interval := ttl / 4
+	if interval > maxExpiryInterval {
+		interval = maxExpiryInterval
+	}
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for range ticker.C {
+			cutoff := time.Now().Add(-ttl)
+			if expired := series.Expire(cutoff); expired > 0 {
+				logger.Debugf("Expired %d series idle for more than %s", expired, ttl)
+			}
+			if expired := expireEndpointStats(cutoff); expired > 0 {
+				logger.Debugf("Expired stats of %d endpoints idle for more than %s", expired, ttl)
+			}
+		}
+	}()
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSeriesExpiryCoversSequenceCounters(t *testing.T) {
+	tracker := &sequenceTracker{sources: make(map[string]*sourceSequence)}
+	now := time.Now()
+	for _, count := range []int{5000, 5010, 5005, 1} {
+		tracker.Observe("expiry-test", count, now)
+	}
+	for name, value := range map[string]float64{
+		"missed":       testutil.ToFloat64(logMissedRequests.WithLabelValues("expiry-test")),
+		"out of order": testutil.ToFloat64(logOutOfOrderLines.WithLabelValues("expiry-test")),
+		"resets":       testutil.ToFloat64(logSequenceResets.WithLabelValues("expiry-test")),
+	} {
+		if value == 0 {
+			t.Fatalf("%s counter was not updated", name)
+		}
+	}
+
+	series.Expire(time.Now().Add(time.Second))
+
+	for name, vec := range map[string]deletableVec{
+		"missed":       logMissedRequests,
+		"out of order": logOutOfOrderLines,
+		"resets":       logSequenceResets,
+	} {
+		if vec.DeleteLabelValues("expiry-test") {
+			t.Errorf("idle %s series was not expired", name)
+		}
+	}
+}
@@ -42,10 +42,10 @@ func NewFileLogSource(logFileConfig *LogFileConfig) (*FileLogSource, error) {
 		defer close(fls.lines)
 		for line := range t.Lines {
 			if line.Err != nil {
-				fls.lines <- LogLine{Text: "", Time: line.Time, Err: line.Err}
+				fls.lines <- LogLine{Text: "", Time: line.Time, Source: fls.filename, Err: line.Err}
 				continue
 			}
-			fls.lines <- LogLine{Text: line.Text, Time: line.Time, Err: nil}
+			fls.lines <- LogLine{Text: line.Text, Time: line.Time, Source: fls.filename, Err: nil}
 		}
 	}()
 
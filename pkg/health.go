@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"sync/atomic"
 	"time"
@@ -95,6 +96,17 @@ func HealthHandler(w http.ResponseWriter, r *http.Request) {
 		response.Components["log_processing"] = "active"
 	}
 
+	// Check whether we are losing access log lines
+	if ratio, source := sequences.LossRatio(); ratio > logLossThreshold {
+		response.Components["log_sequence"] = "lossy"
+		if response.Status == "healthy" {
+			response.Status = "degraded"
+			response.Error = fmt.Sprintf("Missing %.1f%% of access log lines from %s", ratio*100, source)
+		}
+	} else {
+		response.Components["log_sequence"] = "complete"
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	if response.Status != "healthy" {
 		w.WriteHeader(http.StatusServiceUnavailable)
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultNativeBucketFactor     = 1.1
+	defaultNativeMaxBuckets       = 160
+	defaultNativeMinResetDuration = time.Hour
+)
+
+// NativeHistogramsConfig makes the latency histograms native (sparse) histograms,
+// whose exponential buckets give high resolution without a series per bucket
+type NativeHistogramsConfig struct {
+	Enabled bool `json:"Enabled"`
+	// BucketFactor is the maximum ratio between the bounds of a bucket, 1.1 by default
+	BucketFactor float64 `json:"BucketFactor"`
+	// MaxBuckets caps the buckets per histogram, resolution is halved beyond it. 160 by default
+	MaxBuckets uint32 `json:"MaxBuckets"`
+	// MinResetDuration is how long a histogram is kept before it may be reset
+	// to respect MaxBuckets, 1h by default
+	MinResetDuration string `json:"MinResetDuration"`
+
+	minResetDuration time.Duration
+}
+
+func (n *NativeHistogramsConfig) compile() {
+	if !n.Enabled {
+		return
+	}
+	if n.BucketFactor == 0 {
+		n.BucketFactor = defaultNativeBucketFactor
+	} else if n.BucketFactor <= 1 {
+		logger.Warnf("Invalid NativeHistograms BucketFactor %v - it needs to be greater than 1, using %v", n.BucketFactor, defaultNativeBucketFactor)
+		n.BucketFactor = defaultNativeBucketFactor
+	}
+	if n.MaxBuckets == 0 {
+		n.MaxBuckets = defaultNativeMaxBuckets
+	}
+	n.minResetDuration = defaultNativeMinResetDuration
+	if n.MinResetDuration != "" {
+		duration, err := time.ParseDuration(n.MinResetDuration)
+		if err != nil {
+			logger.Warnf("Invalid NativeHistograms MinResetDuration '%s': %v - using %s", n.MinResetDuration, err, defaultNativeMinResetDuration)
+		} else {
+			n.minResetDuration = duration
+		}
+	}
+}
+
+// histogramLayout describes the buckets of a latency histogram series
+type histogramLayout struct {
+	buckets []float64
+	native  NativeHistogramsConfig
+}
+
+// key identifies the layout, series with equal keys share a HistogramVec
+func (l histogramLayout) key() string {
+	if !l.native.Enabled {
+		return fmt.Sprint(l.buckets)
+	}
+	return fmt.Sprintf("%v native:%v/%d/%s", l.buckets, l.native.BucketFactor, l.native.MaxBuckets, l.native.minResetDuration)
+}
+
+// apply sets the buckets of the layout on opts
+func (l histogramLayout) apply(opts *prometheus.HistogramOpts) {
+	opts.Buckets = l.buckets
+	if l.native.Enabled {
+		opts.NativeHistogramBucketFactor = l.native.BucketFactor
+		opts.NativeHistogramMaxBucketNumber = l.native.MaxBuckets
+		opts.NativeHistogramMinResetDuration = l.native.minResetDuration
+	}
+}
+
+// validateBuckets checks that buckets are positive and strictly increasing
+func validateBuckets(buckets []float64) error {
+	for i, bucket := range buckets {
+		if bucket <= 0 {
+			return fmt.Errorf("bucket %v must be positive", bucket)
+		}
+		if i > 0 && bucket <= buckets[i-1] {
+			return fmt.Errorf("bucket %v must be greater than %v", bucket, buckets[i-1])
+		}
+	}
+	return nil
+}
+
+// compileBuckets returns the buckets, or nil with a warning if they are invalid
+func compileBuckets(setting string, buckets []float64) []float64 {
+	if err := validateBuckets(buckets); err != nil {
+		logger.Warnf("Invalid %s: %v - they will be ignored", setting, err)
+		return nil
+	}
+	return buckets
+}
+
+// LatencyHistogramFor returns the layout of the latency histograms of an
+// endpoint of the service, or of the whole service if endpoint is empty
+func (c *TraefikOfficerConfig) LatencyHistogramFor(service, endpoint string) histogramLayout {
+	layout := histogramLayout{buckets: c.BucketsFor(service, endpoint), native: c.NativeHistograms}
+	// Native histograms only keep classic buckets that are configured explicitly
+	if layout.buckets == nil && !c.NativeHistograms.Enabled {
+		layout.buckets = prometheus.DefBuckets
+	}
+	return layout
+}
+
+// BucketsFor returns the configured latency buckets of the endpoint, falling
+// back to those of the service and then to the global ones. It returns nil if
+// none are configured.
+func (c *TraefikOfficerConfig) BucketsFor(service, endpoint string) []float64 {
+	if svc := c.Service(service); svc != nil {
+		if buckets := svc.EndpointBuckets[endpoint]; endpoint != "" && len(buckets) > 0 {
+			return buckets
+		}
+		if len(svc.Buckets) > 0 {
+			return svc.Buckets
+		}
+	}
+	if len(c.Buckets) > 0 {
+		return c.Buckets
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestBucketsFor(t *testing.T) {
+	config := &TraefikOfficerConfig{
+		Buckets: []float64{0.1, 1},
+		Services: []ServiceConfig{{
+			Namespace:       "shop",
+			Name:            "store",
+			Buckets:         []float64{0.5, 5},
+			EndpointBuckets: map[string][]float64{"/export": {10, 60}},
+		}, {
+			Namespace:       "shop",
+			Name:            "cart",
+			EndpointBuckets: map[string][]float64{"/checkout": {1, 2}},
+		}},
+	}
+	config.compile()
+	store, cart := config.Services[0].Key(), config.Services[1].Key()
+
+	tests := []struct {
+		name     string
+		service  string
+		endpoint string
+		want     []float64
+	}{
+		{name: "endpoint buckets", service: store, endpoint: "/export", want: []float64{10, 60}},
+		{name: "service buckets", service: store, endpoint: "/search", want: []float64{0.5, 5}},
+		{name: "service buckets for the whole service", service: store, want: []float64{0.5, 5}},
+		{name: "endpoint buckets without service buckets", service: cart, endpoint: "/checkout", want: []float64{1, 2}},
+		{name: "global buckets", service: cart, endpoint: "/items", want: []float64{0.1, 1}},
+		{name: "unconfigured service", service: "other", endpoint: "/export", want: []float64{0.1, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := config.BucketsFor(tt.service, tt.endpoint); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BucketsFor(%q, %q) = %v, want %v", tt.service, tt.endpoint, got, tt.want)
+			}
+		})
+	}
+
+	unconfigured := &TraefikOfficerConfig{}
+	unconfigured.compile()
+	if got := unconfigured.BucketsFor(store, "/export"); got != nil {
+		t.Errorf("BucketsFor without buckets = %v, want nil", got)
+	}
+	if got := unconfigured.LatencyHistogramFor(store, ""); !reflect.DeepEqual(got.buckets, prometheus.DefBuckets) {
+		t.Errorf("LatencyHistogramFor without buckets = %v, want the default buckets", got.buckets)
+	}
+}
+
+func TestNativeHistogramsConfigCompile(t *testing.T) {
+	tests := []struct {
+		name   string
+		config NativeHistogramsConfig
+		want   NativeHistogramsConfig
+	}{
+		{
+			name:   "disabled",
+			config: NativeHistogramsConfig{BucketFactor: 0.5},
+			want:   NativeHistogramsConfig{BucketFactor: 0.5},
+		},
+		{
+			name:   "defaults",
+			config: NativeHistogramsConfig{Enabled: true},
+			want:   NativeHistogramsConfig{Enabled: true, BucketFactor: 1.1, MaxBuckets: 160, minResetDuration: time.Hour},
+		},
+		{
+			name:   "configured",
+			config: NativeHistogramsConfig{Enabled: true, BucketFactor: 1.05, MaxBuckets: 80, MinResetDuration: "6h"},
+			want:   NativeHistogramsConfig{Enabled: true, BucketFactor: 1.05, MaxBuckets: 80, MinResetDuration: "6h", minResetDuration: 6 * time.Hour},
+		},
+		{
+			name:   "invalid settings fall back to the defaults",
+			config: NativeHistogramsConfig{Enabled: true, BucketFactor: 1, MinResetDuration: "soon"},
+			want:   NativeHistogramsConfig{Enabled: true, BucketFactor: 1.1, MaxBuckets: 160, MinResetDuration: "soon", minResetDuration: time.Hour},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.compile()
+			if tt.config != tt.want {
+				t.Errorf("compile() = %+v, want %+v", tt.config, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistogramSetLayouts(t *testing.T) {
+	hs := newHistogramSet(prometheus.HistogramOpts{Name: "histogram_set_test_seconds", Help: "Test"}, []string{"app"})
+	coarse := histogramLayout{buckets: []float64{1}}
+	fine := histogramLayout{buckets: []float64{0.1, 0.5, 1}}
+
+	hs.WithLabelValues(coarse, "store").Observe(0.2)
+	hs.WithLabelValues(coarse, "cart").Observe(0.2)
+	hs.WithLabelValues(coarse, "store").Observe(0.3)
+	if got := testutil.CollectAndCount(hs); got != 2 {
+		t.Fatalf("series = %d, want 2", got)
+	}
+
+	// The store series restarts with the fine buckets, cart keeps its own
+	hs.WithLabelValues(fine, "store").Observe(0.2)
+	if got := testutil.CollectAndCount(hs); got != 2 {
+		t.Errorf("series after the layout change = %d, want 2", got)
+	}
+	buckets := map[string]int{}
+	counts := map[string]uint64{}
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(hs)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gathering: %v", err)
+	}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			app := metric.GetLabel()[0].GetValue()
+			buckets[app] = len(metric.GetHistogram().GetBucket())
+			counts[app] = metric.GetHistogram().GetSampleCount()
+		}
+	}
+	if buckets["store"] != 3 || counts["store"] != 1 || buckets["cart"] != 1 || counts["cart"] != 1 {
+		t.Errorf("buckets = %v and counts = %v, want store with 3 buckets and 1 request and cart with 1 bucket and 1 request", buckets, counts)
+	}
+
+	if !hs.DeleteLabelValues("store") || hs.DeleteLabelValues("store") {
+		t.Errorf("DeleteLabelValues should delete the series once")
+	}
+	if got := testutil.CollectAndCount(hs); got != 1 {
+		t.Errorf("series after deleting = %d, want 1", got)
+	}
+}
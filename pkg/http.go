@@ -17,8 +17,13 @@ func serveProm(port string) error {
 	addr := ":" + port
 
 	// Register handlers
-	http.Handle("/metrics", http.HandlerFunc(metricsHandlerWithGaugeReset))
+	http.Handle("/metrics", promhttp.Handler())
 	http.HandleFunc("/health", HealthHandler)
+	http.HandleFunc("/services", DiscoveredServicesHandler)
+	http.HandleFunc("/templates", LearnedTemplatesHandler)
+	http.HandleFunc("/sketches", SketchesHandler)
+	http.HandleFunc("/slos", SLOsHandler)
+	http.HandleFunc("/clients", ClientsHandler)
 
 	logger.Infof("Starting metrics server on %s/metrics", addr)
 	logger.Infof("Health check available at %s/health", addr)
@@ -48,12 +53,3 @@ func serveProm(port string) error {
 		return nil
 	}
 }
-
-func metricsHandlerWithGaugeReset(w http.ResponseWriter, r *http.Request) {
-	// Serve metrics
-	promhttp.Handler().ServeHTTP(w, r)
-
-	endpointErrorRate.Reset()
-	endpointClientErrorRate.Reset()
-	endpointServerErrorRate.Reset()
-}
@@ -17,7 +17,11 @@ import (
 	v1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
@@ -28,6 +32,7 @@ const (
 	maxBackoff          = 1 * time.Minute  // Reduced from 5 minutes
 	syncInterval        = 10 * time.Second // Reduced from 30s for faster recovery
 	podDiscoveryTimeout = 15 * time.Second // Reduced from 5m for faster pod discovery
+	informerResync      = 10 * time.Minute
 )
 
 // podStream represents a running log stream for a pod
@@ -63,6 +68,30 @@ type K8SConfig struct {
 	Namespace     string
 	ContainerName string
 	LabelSelector string
+
+	// Metadata discovery from Kubernetes objects
+	DiscoverServices      bool
+	WatchOfficerResources bool
+	// OfficerResourcesAllowServices lets TraefikOfficer resources opt their service in
+	OfficerResourcesAllowServices bool
+	WorkloadMetadata              bool
+	ResolveBackendPods            bool
+	DiscoveryNamespace            string
+}
+
+// WatchersEnabled reports whether any Kubernetes object watcher is enabled
+func (c *K8SConfig) WatchersEnabled() bool {
+	return c.DiscoverServices || c.WatchOfficerResources || c.WorkloadMetadata || c.ResolveBackendPods
+}
+
+// KubernetesInformers holds the clients and shared informer factories used to
+// watch Kubernetes objects for metadata. Watchers register their informers
+// before Start is called.
+type KubernetesInformers struct {
+	Client         kubernetes.Interface
+	Dynamic        dynamic.Interface
+	Factory        informers.SharedInformerFactory
+	DynamicFactory dynamicinformer.DynamicSharedInformerFactory
 }
 
 // NewKubernetesConfig creates a new Kubernetes client configuration
@@ -109,6 +138,75 @@ func NewKubernetesClientset(config K8SConfig) (*kubernetes.Clientset, error) {
 	return kubernetes.NewForConfig(kubeConfig)
 }
 
+// NewKubernetesDynamicClient creates a new dynamic client for custom resources
+func NewKubernetesDynamicClient(config K8SConfig) (dynamic.Interface, error) {
+	kubeConfig, err := NewKubernetesConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return dynamic.NewForConfig(kubeConfig)
+}
+
+// NewKubernetesInformers creates shared informer factories scoped to namespace,
+// or to all namespaces when it is empty
+func NewKubernetesInformers(client kubernetes.Interface, dynamicClient dynamic.Interface, namespace string) *KubernetesInformers {
+	return &KubernetesInformers{
+		Client:  client,
+		Dynamic: dynamicClient,
+		Factory: informers.NewSharedInformerFactoryWithOptions(client, informerResync,
+			informers.WithNamespace(namespace)),
+		DynamicFactory: dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, informerResync,
+			namespace, nil),
+	}
+}
+
+// NewKubernetesInformersFromConfig builds the clients from the command line configuration
+func NewKubernetesInformersFromConfig(config K8SConfig) (*KubernetesInformers, error) {
+	client, err := NewKubernetesClientset(config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating Kubernetes client: %w", err)
+	}
+	dynamicClient, err := NewKubernetesDynamicClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating Kubernetes dynamic client: %w", err)
+	}
+	return NewKubernetesInformers(client, dynamicClient, config.DiscoveryNamespace), nil
+}
+
+// Start starts all registered informers and waits for their caches to fill
+func (ki *KubernetesInformers) Start(stopCh <-chan struct{}) error {
+	ki.Factory.Start(stopCh)
+	ki.DynamicFactory.Start(stopCh)
+
+	for informerType, synced := range ki.Factory.WaitForCacheSync(stopCh) {
+		if !synced {
+			return fmt.Errorf("timed out waiting for %v cache to sync", informerType)
+		}
+	}
+	for gvr, synced := range ki.DynamicFactory.WaitForCacheSync(stopCh) {
+		if !synced {
+			return fmt.Errorf("timed out waiting for %s cache to sync", gvr.String())
+		}
+	}
+	return nil
+}
+
+// HasResource reports whether the API server serves the given resource, so
+// informers are not started for CRDs that are not installed
+func (ki *KubernetesInformers) HasResource(gvr schema.GroupVersionResource) bool {
+	resources, err := ki.Client.Discovery().ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+	if err != nil {
+		return false
+	}
+	for _, r := range resources.APIResources {
+		if r.Name == gvr.Resource {
+			return true
+		}
+	}
+	return false
+}
+
 // NewKubernetesLogSource creates a new Kubernetes-based log source
 func NewKubernetesLogSource(k8sConfig *K8SConfig) (*KubernetesLogSource, error) {
 	clientSet, err := NewKubernetesClientset(*k8sConfig)
@@ -234,6 +332,7 @@ func (kls *KubernetesLogSource) syncPods() (bool, error) {
 			logger.Infof("Removing log stream for pod %s (pod no longer exists)", podName)
 			stream.cancelFunc()
 			delete(kls.podStreams, podName)
+			sequences.Forget(podName)
 		}
 	}
 
@@ -377,9 +476,10 @@ func (kls *KubernetesLogSource) streamPodLogs(ctx context.Context, podName strin
 			return nil
 		default:
 			kls.lines <- LogLine{
-				Text: fmt.Sprintf("[%s] %s", podName, scanner.Text()),
-				Time: time.Now(),
-				Err:  nil,
+				Text:   fmt.Sprintf("[%s] %s", podName, scanner.Text()),
+				Time:   time.Now(),
+				Source: podName,
+				Err:    nil,
 			}
 		}
 	}
@@ -425,6 +525,18 @@ func AddKubernetesFlags(flags *flag.FlagSet) *K8SConfig {
 		"Label selector for pods (e.g., 'app=myapp')")
 	flags.StringVar(&config.ContainerName, "container-name", "traefik",
 		"Container name in the pods")
+	flags.BoolVar(&config.DiscoverServices, "discover-services", false,
+		"Watch IngressRoute and Ingress objects to discover services and their router names")
+	flags.BoolVar(&config.WatchOfficerResources, "watch-officer-resources", false,
+		"Merge per-service settings from TraefikOfficer custom resources into the configuration")
+	flags.BoolVar(&config.OfficerResourcesAllowServices, "officer-resources-allow-services", false,
+		"Report on services configured by a TraefikOfficer resource even if they are not in AllowedServices")
+	flags.BoolVar(&config.WorkloadMetadata, "workload-metadata", false,
+		"Resolve routers to their Deployment or StatefulSet and export workload metrics with allowlisted labels")
+	flags.BoolVar(&config.ResolveBackendPods, "resolve-backend-pods", false,
+		"Watch EndpointSlices to resolve the backend address of each request to its pod for the backend metrics")
+	flags.StringVar(&config.DiscoveryNamespace, "discovery-namespace", "",
+		"Namespace to watch for discovery (default is all namespaces)")
 
 	return config
 }
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	learnedParam = "{param}"
+
+	defaultLearnerMaxChildren = 25
+	defaultLearnerMaxNodes    = 10000
+	defaultLearnerIdleTTL     = 7 * 24 * time.Hour
+	learnerMaxDepth           = 32
+	learnerSaveInterval       = time.Minute
+
+	// A position only becomes {param} when at least half of its values were seen
+	// at most learnerRareVisits times and these rare values carry at least
+	// learnerMinRareTraffic of its requests. A scanner probing random names next
+	// to a few busy static ones does not qualify.
+	learnerRareVisits     = 2
+	learnerMinRareTraffic = 0.1
+)
+
+var (
+	// templateLearner is nil unless template learning is enabled
+	templateLearner *TemplateLearner
+
+	// templateResetEnabled lets DELETE /templates forget learned templates. It is
+	// off by default because the endpoint shares the unauthenticated metrics port.
+	templateResetEnabled bool
+)
+
+// TemplateLearningConfig configures automatic endpoint template learning
+type TemplateLearningConfig struct {
+	Enabled     bool   `json:"Enabled"`
+	MaxChildren int    `json:"MaxChildren"` // distinct values at one position before it becomes {param}
+	MaxNodes    int    `json:"MaxNodes"`    // per service, unseen segments become {param} beyond it
+	StateFile   string `json:"StateFile"`   // where learned templates are kept across restarts
+	IdleTTL     string `json:"IdleTTL"`     // learned segments and params unused for this long are forgotten, 7d by default
+
+	idleTTL time.Duration
+}
+
+// templateNode is one path segment position in a service's prefix tree.
+// Once a position has too many distinct values that look variable its
+// children are merged into Param.
+type templateNode struct {
+	Children map[string]*templateNode `json:"children,omitempty"`
+	Param    *templateNode            `json:"param,omitempty"`
+	Hits     int64                    `json:"hits,omitempty"`      // requests whose path ended here
+	Visits   int64                    `json:"visits,omitempty"`    // requests whose path went through here
+	LastSeen int64                    `json:"last_seen,omitempty"` // unix time of the last visit
+}
+
+func (n *templateNode) visit(now int64) {
+	n.Visits++
+	n.LastSeen = now
+}
+
+// variable reports whether the children of n look like the values of a
+// parameter rather than a fixed set of names
+func (n *templateNode) variable() bool {
+	rare := 0
+	var visits, rareVisits int64
+	for _, child := range n.Children {
+		visits += child.Visits
+		if child.Visits <= learnerRareVisits {
+			rare++
+			rareVisits += child.Visits
+		}
+	}
+	return 2*rare >= len(n.Children) && float64(rareVisits) >= learnerMinRareTraffic*float64(visits)
+}
+
+// prune removes the children and param of n last visited before cutoff
+func (n *templateNode) prune(cutoff int64) {
+	if n.Param != nil {
+		if n.Param.LastSeen < cutoff {
+			n.Param = nil
+		} else {
+			n.Param.prune(cutoff)
+		}
+	}
+	for segment, child := range n.Children {
+		if child.LastSeen < cutoff {
+			delete(n.Children, segment)
+			continue
+		}
+		child.prune(cutoff)
+	}
+}
+
+// stamp sets the last visit of nodes that have none, e.g. from older state files
+func (n *templateNode) stamp(now int64) {
+	if n.LastSeen == 0 {
+		n.LastSeen = now
+	}
+	if n.Param != nil {
+		n.Param.stamp(now)
+	}
+	for _, child := range n.Children {
+		child.stamp(now)
+	}
+}
+
+// size returns the number of nodes in the subtree, including n
+func (n *templateNode) size() int {
+	total := 1
+	for _, child := range n.Children {
+		total += child.size()
+	}
+	if n.Param != nil {
+		total += n.Param.size()
+	}
+	return total
+}
+
+// mergeInto folds the subtree of n into target
+func (n *templateNode) mergeInto(target *templateNode) {
+	target.Hits += n.Hits
+	target.Visits += n.Visits
+	target.LastSeen = max(target.LastSeen, n.LastSeen)
+	if n.Param != nil {
+		if target.Param == nil {
+			target.Param = &templateNode{}
+		}
+		n.Param.mergeInto(target.Param)
+	}
+	for segment, child := range n.Children {
+		if target.Param != nil {
+			child.mergeInto(target.Param)
+			continue
+		}
+		if target.Children == nil {
+			target.Children = make(map[string]*templateNode)
+		}
+		existing, exists := target.Children[segment]
+		if !exists {
+			existing = &templateNode{}
+			target.Children[segment] = existing
+		}
+		child.mergeInto(existing)
+	}
+}
+
+// serviceTemplates is the prefix tree of one service
+type serviceTemplates struct {
+	Root  *templateNode `json:"root"`
+	Nodes int           `json:"nodes"`
+}
+
+// TemplateLearner learns per service which path segment positions hold
+// high-cardinality values, in the spirit of the Drain log template miner
+type TemplateLearner struct {
+	config TemplateLearningConfig
+
+	mu       sync.Mutex
+	services map[string]*serviceTemplates
+	dirty    bool
+}
+
+// NewTemplateLearner creates a learner and loads previously learned templates
+func NewTemplateLearner(config TemplateLearningConfig) *TemplateLearner {
+	if config.MaxChildren <= 0 {
+		config.MaxChildren = defaultLearnerMaxChildren
+	}
+	if config.MaxNodes <= 0 {
+		config.MaxNodes = defaultLearnerMaxNodes
+	}
+	config.idleTTL = defaultLearnerIdleTTL
+	if config.IdleTTL != "" {
+		idleTTL, err := parseLongDuration(config.IdleTTL)
+		if err != nil {
+			logger.Warnf("Invalid TemplateLearning IdleTTL '%s': %v - using %s", config.IdleTTL, err, defaultLearnerIdleTTL)
+		} else {
+			config.idleTTL = idleTTL
+		}
+	}
+
+	tl := &TemplateLearner{config: config, services: make(map[string]*serviceTemplates)}
+	if config.StateFile != "" {
+		if err := tl.load(); err != nil {
+			logger.Warnf("Failed to load learned templates from %s: %v", config.StateFile, err)
+		}
+	}
+	return tl
+}
+
+// Normalize learns from the path and returns it with variable segments replaced by {param}
+func (tl *TemplateLearner) Normalize(service, path string) string {
+	if tl == nil || path == "" || path == "/" {
+		return path
+	}
+
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(segments) > learnerMaxDepth {
+		return path
+	}
+
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	tree, exists := tl.services[service]
+	if !exists {
+		tree = &serviceTemplates{Root: &templateNode{}, Nodes: 1}
+		tl.services[service] = tree
+	}
+
+	now := time.Now().Unix()
+	node := tree.Root
+	node.visit(now)
+	for i, segment := range segments {
+		if node.Param != nil {
+			segments[i] = learnedParam
+			node = node.Param
+			node.visit(now)
+			continue
+		}
+
+		child, known := node.Children[segment]
+		if !known {
+			full := len(node.Children) >= tl.config.MaxChildren
+			switch {
+			// The first segment names the API rather than a value, so it never collapses
+			case full && i > 0 && node.variable():
+				tl.collapse(tree, node)
+				logger.Infof("Learned template position for %s: /%s", service, strings.Join(append(segments[:i:i], learnedParam), "/"))
+				segments[i] = learnedParam
+				node = node.Param
+				node.visit(now)
+				continue
+			case full || tree.Nodes >= tl.config.MaxNodes:
+				// Out of room, report as a parameter without learning it
+				segments[i] = learnedParam
+				for j := i + 1; j < len(segments); j++ {
+					segments[j] = learnedParam
+				}
+				return "/" + strings.Join(segments, "/")
+			}
+			if node.Children == nil {
+				node.Children = make(map[string]*templateNode)
+			}
+			child = &templateNode{}
+			node.Children[segment] = child
+			tree.Nodes++
+			tl.dirty = true
+		}
+		node = child
+		node.visit(now)
+	}
+	node.Hits++
+
+	return "/" + strings.Join(segments, "/")
+}
+
+// collapse merges all children of node into a single parameter child
+func (tl *TemplateLearner) collapse(tree *serviceTemplates, node *templateNode) {
+	param := &templateNode{}
+	for _, child := range node.Children {
+		child.mergeInto(param)
+	}
+	node.Children = nil
+	node.Param = param
+	tree.Nodes = tree.Root.size()
+	tl.dirty = true
+}
+
+// Expire forgets the segments and params of every service not used for longer
+// than IdleTTL, so positions can be learned again
+func (tl *TemplateLearner) Expire() {
+	if tl == nil || tl.config.idleTTL <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-tl.config.idleTTL).Unix()
+
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	for _, tree := range tl.services {
+		tree.Root.prune(cutoff)
+		if nodes := tree.Root.size(); nodes != tree.Nodes {
+			tree.Nodes = nodes
+			tl.dirty = true
+		}
+	}
+}
+
+// Reset forgets everything learned for the service, or for all services if it is empty
+func (tl *TemplateLearner) Reset(service string) {
+	if tl == nil {
+		return
+	}
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	tl.dirty = true
+	if service == "" {
+		tl.services = make(map[string]*serviceTemplates)
+		logger.Info("Reset learned templates of all services")
+		return
+	}
+	delete(tl.services, service)
+	logger.Infof("Reset learned templates of %s", service)
+}
+
+// LearnedTemplate is a template and the number of requests seen for it
+type LearnedTemplate struct {
+	Template string `json:"template"`
+	Hits     int64  `json:"hits"`
+}
+
+// Templates returns the learned templates per service, most requested first
+func (tl *TemplateLearner) Templates() map[string][]LearnedTemplate {
+	result := make(map[string][]LearnedTemplate)
+	if tl == nil {
+		return result
+	}
+
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	for service, tree := range tl.services {
+		var templates []LearnedTemplate
+		var walk func(node *templateNode, prefix string)
+		walk = func(node *templateNode, prefix string) {
+			if node.Hits > 0 {
+				template := prefix
+				if template == "" {
+					template = "/"
+				}
+				templates = append(templates, LearnedTemplate{Template: template, Hits: node.Hits})
+			}
+			if node.Param != nil {
+				walk(node.Param, prefix+"/"+learnedParam)
+			}
+			for segment, child := range node.Children {
+				walk(child, prefix+"/"+segment)
+			}
+		}
+		walk(tree.Root, "")
+
+		sort.Slice(templates, func(i, j int) bool {
+			if templates[i].Hits != templates[j].Hits {
+				return templates[i].Hits > templates[j].Hits
+			}
+			return templates[i].Template < templates[j].Template
+		})
+		result[service] = templates
+	}
+	return result
+}
+
+func (tl *TemplateLearner) load() error {
+	data, err := os.ReadFile(tl.config.StateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	services := make(map[string]*serviceTemplates)
+	if err := json.Unmarshal(data, &services); err != nil {
+		return fmt.Errorf("failed to parse learned templates: %w", err)
+	}
+	now := time.Now().Unix()
+	for service, tree := range services {
+		if tree.Root == nil {
+			delete(services, service)
+			continue
+		}
+		tree.Root.stamp(now)
+		tree.Nodes = tree.Root.size()
+	}
+
+	tl.mu.Lock()
+	tl.services = services
+	tl.mu.Unlock()
+	logger.Infof("Loaded learned templates for %d services from %s", len(services), tl.config.StateFile)
+	return nil
+}
+
+// Save writes the learned templates to the state file if they changed
+func (tl *TemplateLearner) Save() error {
+	if tl == nil || tl.config.StateFile == "" {
+		return nil
+	}
+
+	tl.mu.Lock()
+	if !tl.dirty {
+		tl.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(tl.services)
+	tl.dirty = false
+	tl.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode learned templates: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated state
+	tmp := tl.config.StateFile + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(tl.config.StateFile), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", tl.config.StateFile, err)
+	}
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, tl.config.StateFile); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", tl.config.StateFile, err)
+	}
+	return nil
+}
+
+func startTemplateLearnerSaver(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for range ticker.C {
+			templateLearner.Expire()
+			if err := templateLearner.Save(); err != nil {
+				logger.Errorf("Error saving learned templates: %v", err)
+			}
+		}
+	}()
+}
+
+// LearnedTemplatesHandler serves the learned templates per service. If enabled,
+// DELETE forgets them, for the service query parameter only if it is given.
+func LearnedTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && (r.Method != http.MethodDelete || !templateResetEnabled) {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		templateLearner.Reset(r.URL.Query().Get("service"))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(templateLearner.Templates())
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTemplateLearnerNormalize(t *testing.T) {
+	tests := []struct {
+		name  string
+		learn func(tl *TemplateLearner)
+		path  string
+		want  string
+	}{
+		{
+			name: "ids collapse",
+			learn: func(tl *TemplateLearner) {
+				for i := 0; i < 10; i++ {
+					tl.Normalize("svc", fmt.Sprintf("/api/posts/%d", i))
+				}
+			},
+			path: "/api/posts/12345",
+			want: "/api/posts/{param}",
+		},
+		{
+			name: "first segment never collapses",
+			learn: func(tl *TemplateLearner) {
+				for i := 0; i < 10; i++ {
+					tl.Normalize("svc", fmt.Sprintf("/probe-%d", i))
+				}
+			},
+			path: "/api/posts",
+			want: "/{param}/{param}",
+		},
+		{
+			name: "known paths stay static",
+			learn: func(tl *TemplateLearner) {
+				tl.Normalize("svc", "/api/users")
+			},
+			path: "/api/users",
+			want: "/api/users",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tl := NewTemplateLearner(TemplateLearningConfig{MaxChildren: 5})
+			tt.learn(tl)
+			if got := tl.Normalize("svc", tt.path); got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateLearnerScannerDoesNotCollapse(t *testing.T) {
+	tl := NewTemplateLearner(TemplateLearningConfig{MaxChildren: 5})
+	for i := 0; i < 100; i++ {
+		tl.Normalize("svc", "/api/users")
+		tl.Normalize("svc", "/api/orders")
+	}
+	for i := 0; i < 10; i++ {
+		tl.Normalize("svc", fmt.Sprintf("/api/probe-%d", i))
+	}
+	if got := tl.Normalize("svc", "/api/orders"); got != "/api/orders" {
+		t.Errorf("Normalize(/api/orders) = %q after a scan, want it unchanged", got)
+	}
+	if tl.services["svc"].Root.Children["api"].Param != nil {
+		t.Error("/api/* was learned as a parameter from scanner traffic")
+	}
+}
+
+func TestTemplateLearnerExpireAndReset(t *testing.T) {
+	tl := NewTemplateLearner(TemplateLearningConfig{MaxChildren: 5, IdleTTL: "1h"})
+	for i := 0; i < 10; i++ {
+		tl.Normalize("svc", fmt.Sprintf("/api/posts/%d", i))
+	}
+	posts := tl.services["svc"].Root.Children["api"].Children["posts"]
+	if posts.Param == nil {
+		t.Fatal("/api/posts/* was not learned as a parameter")
+	}
+
+	posts.Param.LastSeen = time.Now().Add(-2 * time.Hour).Unix()
+	tl.Expire()
+	if posts.Param != nil {
+		t.Error("idle parameter was not forgotten")
+	}
+	if got := tl.Normalize("svc", "/api/posts/1"); got != "/api/posts/1" {
+		t.Errorf("Normalize after expiry = %q, want /api/posts/1", got)
+	}
+
+	tl.Reset("svc")
+	if len(tl.Templates()) != 0 {
+		t.Errorf("templates after reset = %v, want none", tl.Templates())
+	}
+}
+
+func TestLearnedTemplatesHandlerReset(t *testing.T) {
+	previous := templateLearner
+	t.Cleanup(func() {
+		templateLearner = previous
+		templateResetEnabled = false
+	})
+	templateLearner = NewTemplateLearner(TemplateLearningConfig{MaxChildren: 5})
+	for i := 0; i < 10; i++ {
+		templateLearner.Normalize("svc", fmt.Sprintf("/api/posts/%d", i))
+	}
+
+	tests := []struct {
+		name          string
+		method        string
+		resetEnabled  bool
+		wantStatus    int
+		wantTemplates int
+	}{
+		{name: "list", method: http.MethodGet, wantStatus: http.StatusOK, wantTemplates: 1},
+		{name: "delete without the flag", method: http.MethodDelete, wantStatus: http.StatusMethodNotAllowed, wantTemplates: 1},
+		{name: "other methods", method: http.MethodPost, resetEnabled: true, wantStatus: http.StatusMethodNotAllowed, wantTemplates: 1},
+		{name: "delete with the flag", method: http.MethodDelete, resetEnabled: true, wantStatus: http.StatusNoContent, wantTemplates: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			templateResetEnabled = tt.resetEnabled
+			recorder := httptest.NewRecorder()
+			LearnedTemplatesHandler(recorder, httptest.NewRequest(tt.method, "/templates?service=svc", nil))
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("%s /templates = %d, want %d", tt.method, recorder.Code, tt.wantStatus)
+			}
+			if got := len(templateLearner.Templates()); got != tt.wantTemplates {
+				t.Errorf("services with templates = %d, want %d", got, tt.wantTemplates)
+			}
+		})
+	}
+}
@@ -9,7 +9,7 @@ import (
 
 type parser func(line string) (traefikLogConfig, error)
 
-func processLogs(logSource LogSource, config TraefikOfficerConfig, useK8sPtr *bool, logFileConfig *LogFileConfig, jsonLogsPtr *bool) {
+func processLogs(logSource LogSource, useK8sPtr *bool, logFileConfig *LogFileConfig, jsonLogsPtr *bool) {
 	// Only set up log rotation for file mode
 	var linesToRotate int
 	if !*useK8sPtr {
@@ -67,20 +67,25 @@ func processLogs(logSource LogSource, config TraefikOfficerConfig, useK8sPtr *bo
 			continue
 		}
 
+		// Track the RequestCount sequence before any filtering so gaps reflect lost lines
+		sequences.Observe(logLine.Source, d.RequestCount, logLine.Time)
+
 		// Check if this service should be ignored
-		if !startsWith(config.AllowedServices, d.RouterName) {
-			logger.Debugf("Ignoring service: %s, not in allowed list %s", d.RouterName, config.AllowedServices)
+		config := CurrentConfig()
+		d.Router = routerNames.Parse(d.RouterName)
+		if !isServiceAllowed(config.AllowedServices, d.Router) && !discoveredServices.Allowed(d.Router) {
+			logger.Debugf("Ignoring service: %s (%+v), not in allowed list %s", d.RouterName, d.Router, config.AllowedServices)
 			continue
 		}
 
-		logger.Debugf("Found Matching service: %s, in allowed list", d.RouterName)
-
-		updateMetrics(&d, config.URLPatterns)
+		logger.Debugf("Found Matching service: %s, in allowed list", d.Router.ServiceKey())
 
-		// Only JSON logs have Overhead metrics
-		if *jsonLogsPtr {
-			traefikOverhead.Observe(d.Overhead)
+		if config.IsPathIgnored(d.Router.ServiceKey(), d.RequestPath) {
+			logger.Debugf("Ignoring path: %s for service %s", d.RequestPath, d.Router.ServiceKey())
+			continue
 		}
+
+		updateMetrics(&d, config)
 	}
 }
 
@@ -16,8 +16,13 @@ func main() {
 	servePort := flag.String("listen-port", "8080", "Which port to expose metrics on")
 	jsonLogs := flag.Bool("json-logs", false, "If true, parse JSON logs instead of accessLog format")
 	useK8s := flag.Bool("use-k8s", false, "Read logs from Kubernetes pods instead of file")
+	flag.Float64Var(&logLossThreshold, "log-loss-threshold", logLossThreshold,
+		"Ratio of missed access log lines (from RequestCount gaps) above which health is degraded")
+	flag.BoolVar(&templateResetEnabled, "template-reset", false,
+		"Allow DELETE /templates to forget learned templates. The metrics port has no authentication, so only enable it if the port is not reachable by untrusted clients")
 	logFileConfig := AddFileFlags(flag.CommandLine)
 	k8sConfig := AddKubernetesFlags(flag.CommandLine)
+	rulesConfig := AddRouterRulesFlags(flag.CommandLine)
 
 	flag.Parse()
 
@@ -30,6 +35,7 @@ func main() {
 	if err != nil {
 		logger.Warnf("Failed to load configuration: %v. Using default configuration.", err)
 	}
+	officerConfig.SetBase(config)
 
 	// Log configuration
 	if *useK8s {
@@ -45,9 +51,32 @@ func main() {
 	logger.Info("Config File At:", *configLocation)
 	logger.Info("JSON Logs:", *jsonLogs)
 
+	// Watch Kubernetes objects for metadata
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	if k8sConfig.WatchersEnabled() {
+		startKubernetesWatchers(k8sConfig, stopCh)
+	}
+
+	// Template endpoints from the Traefik router rules
+	if rulesConfig.Enabled() {
+		startRouterRulesRefresher(rulesConfig)
+	}
+
+	// Learn endpoint templates from the paths seen
+	if config.TemplateLearning.Enabled {
+		templateLearner = NewTemplateLearner(config.TemplateLearning)
+		startTemplateLearnerSaver(learnerSaveInterval)
+		defer func() {
+			if err := templateLearner.Save(); err != nil {
+				logger.Errorf("Error saving learned templates: %v", err)
+			}
+		}()
+	}
+
 	// Start background task to update top paths
 	startTopPathsUpdater(30 * time.Second)
-	//startMetricsCleaner(60 * time.Minute)
+	startSeriesExpiry(CurrentConfig().SeriesIdleTTL())
 
 	// Start metrics server
 	go func() {
@@ -76,5 +105,36 @@ func main() {
 
 	// Start log processing
 	logger.Info("Starting log processing")
-	processLogs(logSource, config, useK8s, logFileConfig, jsonLogs)
+	processLogs(logSource, useK8s, logFileConfig, jsonLogs)
+}
+
+// startKubernetesWatchers registers the enabled metadata watchers and waits for their caches
+func startKubernetesWatchers(k8sConfig *K8SConfig, stopCh <-chan struct{}) {
+	kubeInformers, err := NewKubernetesInformersFromConfig(*k8sConfig)
+	if err != nil {
+		UpdateHealthStatus("kubernetes_watchers", "error", err)
+		logger.Errorf("Failed to set up Kubernetes watchers: %v", err)
+		return
+	}
+
+	// Workload metadata needs the IngressRoute and Ingress backends
+	if k8sConfig.DiscoverServices || k8sConfig.WorkloadMetadata {
+		WatchIngressObjects(kubeInformers)
+	}
+	if k8sConfig.WorkloadMetadata {
+		workloads = NewWorkloadResolver(kubeInformers, CurrentConfig().WorkloadMetadata)
+	}
+	if k8sConfig.WatchOfficerResources {
+		WatchOfficerResources(kubeInformers, k8sConfig.OfficerResourcesAllowServices)
+	}
+	if k8sConfig.ResolveBackendPods {
+		backendPods = NewBackendPodResolver(kubeInformers)
+	}
+
+	if err := kubeInformers.Start(stopCh); err != nil {
+		UpdateHealthStatus("kubernetes_watchers", "error", err)
+		logger.Errorf("Failed to start Kubernetes watchers: %v", err)
+		return
+	}
+	UpdateHealthStatus("kubernetes_watchers", "running", nil)
 }
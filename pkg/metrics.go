@@ -6,6 +6,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"regexp"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -19,19 +20,101 @@ type URLPattern struct {
 	Namespace   string         `json:"namespace"`
 }
 
+// otherEndpoint is the request_path label of requests to paths outside the service's top N
+const otherEndpoint = "__other__"
+
 var (
-	// Track metrics for calculating averages and error rates
+	// Track metrics for calculating averages and error rates. The mutex guards
+	// the map, each stat has its own lock for its counts.
 	endpointStats      = make(map[string]*EndpointStat)
 	endpointStatsMutex sync.RWMutex
 )
 
 type EndpointStat struct {
+	mu sync.Mutex
+	// retired is set once the stat is no longer in endpointStats, updates
+	// that looked it up before have to look up its successor
+	retired bool
+
 	TotalRequests    int64
 	TotalDuration    float64
 	MaxDuration      float64
 	ErrorCount       int64
 	ClientErrorCount int64
 	ServerErrorCount int64
+
+	LastSeen time.Time
+
+	// windows holds the requests of the ranking window and of the StatsWindows
+	windows *windowSet
+}
+
+func newEndpointStat(windows []statsWindow) *EndpointStat {
+	lengths := []time.Duration{rankingWindow}
+	for _, window := range windows {
+		lengths = append(lengths, window.length)
+	}
+	return &EndpointStat{windows: newWindowSet(lengths...)}
+}
+
+// endpointStatFor returns the stat of the key locked, creating it if needed
+func endpointStatFor(key string, windows []statsWindow) *EndpointStat {
+	for {
+		endpointStatsMutex.RLock()
+		stat, exists := endpointStats[key]
+		endpointStatsMutex.RUnlock()
+		if !exists {
+			endpointStatsMutex.Lock()
+			if stat, exists = endpointStats[key]; !exists {
+				stat = newEndpointStat(windows)
+				endpointStats[key] = stat
+			}
+			endpointStatsMutex.Unlock()
+		}
+
+		stat.mu.Lock()
+		if !stat.retired {
+			return stat
+		}
+		stat.mu.Unlock()
+	}
+}
+
+// Recent summarizes the requests of the ranking window
+func (es *EndpointStat) Recent(now time.Time) windowSummary {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	summary, _ := es.windows.Summary(rankingWindow, now)
+	return summary
+}
+
+// Window summarizes the requests of one of the StatsWindows, if the stat has it
+func (es *EndpointStat) Window(window statsWindow, now time.Time) (windowSummary, bool) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return es.windows.Summary(window.length, now)
+}
+
+// observe adds a request to the recent windows of the stat
+func (es *EndpointStat) observe(now time.Time, obs requestObservation) {
+	es.LastSeen = now
+	es.windows.Observe(now, obs)
+}
+
+// merge adds the counts of other to the stat, the caller holds both locks
+func (es *EndpointStat) merge(other *EndpointStat) {
+	if other.LastSeen.After(es.LastSeen) {
+		es.LastSeen = other.LastSeen
+	}
+	es.windows.merge(other.windows)
+	es.TotalRequests += other.TotalRequests
+	es.TotalDuration += other.TotalDuration
+	if other.MaxDuration > es.MaxDuration {
+		es.MaxDuration = other.MaxDuration
+	}
+	es.ErrorCount += other.ErrorCount
+	es.ClientErrorCount += other.ClientErrorCount
+	es.ServerErrorCount += other.ServerErrorCount
 }
 
 var (
@@ -49,11 +132,10 @@ var (
 		[]string{"request_method", "response_code", "app"},
 	)
 
-	requestDuration = promauto.NewHistogramVec(
+	requestDuration = registerHistogramSet(
 		prometheus.HistogramOpts{
-			Name:    "traefik_officer_request_duration_seconds",
-			Help:    "Duration of HTTP requests in seconds",
-			Buckets: prometheus.DefBuckets,
+			Name: "traefik_officer_request_duration_seconds",
+			Help: "Duration of HTTP requests in seconds",
 		},
 		[]string{"request_method", "response_code", "app"},
 	)
@@ -67,141 +149,176 @@ var (
 		[]string{"app", "request_path", "request_method", "response_code"},
 	)
 
-	endpointDuration = promauto.NewHistogramVec(
+	endpointDuration = registerHistogramSet(
 		prometheus.HistogramOpts{
-			Name:    "traefik_officer_endpoint_request_duration_seconds",
-			Help:    "Duration of HTTP requests per endpoint in seconds",
-			Buckets: prometheus.DefBuckets,
+			Name: "traefik_officer_endpoint_request_duration_seconds",
+			Help: "Duration of HTTP requests per endpoint in seconds",
 		},
 		[]string{"app", "request_path", "request_method", "response_code"},
 	)
+)
 
-	endpointAvgLatency = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "traefik_officer_endpoint_avg_latency_seconds",
-			Help: "Average latency per endpoint in seconds",
-		},
-		[]string{"app", "request_path"},
-	)
+// histogramSet is a histogram family whose bucket layout can differ per series.
+// Each layout gets its own HistogramVec and every series lives in exactly one of
+// them, so the family stays consistent when the vecs are collected together.
+type histogramSet struct {
+	opts   prometheus.HistogramOpts
+	labels []string
 
-	endpointMaxLatency = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "traefik_officer_endpoint_max_latency_seconds",
-			Help: "Maximum latency per endpoint in seconds",
-		},
-		[]string{"app", "request_path"},
-	)
+	mu     sync.Mutex
+	vecs   map[string]*prometheus.HistogramVec // keyed by bucket layout
+	series map[string]string                   // label values -> bucket layout
+}
 
-	endpointErrorRate = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "traefik_officer_endpoint_error_rate",
-			Help: "Error rate per endpoint (ratio of 4xx/5xx responses)",
-		},
-		[]string{"app", "request_path"},
-	)
+// registerHistogramSet creates a histogramSet and registers it with the default registry
+func registerHistogramSet(opts prometheus.HistogramOpts, labels []string) *histogramSet {
+	hs := newHistogramSet(opts, labels)
+	prometheus.MustRegister(hs)
+	return hs
+}
 
-	endpointClientErrorRate = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "traefik_officer_endpoint_client_error_rate",
-			Help: "Error rate per endpoint (ratio of 4xx responses)",
-		},
-		[]string{"app", "request_path"},
-	)
+func newHistogramSet(opts prometheus.HistogramOpts, labels []string) *histogramSet {
+	return &histogramSet{
+		opts:   opts,
+		labels: labels,
+		vecs:   make(map[string]*prometheus.HistogramVec),
+		series: make(map[string]string),
+	}
+}
 
-	endpointServerErrorRate = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "traefik_officer_endpoint_server_error_rate",
-			Help: "Error rate per endpoint (ratio of 5xx responses)",
-		},
-		[]string{"app", "request_path"},
-	)
-)
+// WithLabelValues returns the histogram for the label values using the given layout.
+// If the series existed with a different layout it is restarted with the new one.
+func (hs *histogramSet) WithLabelValues(layout histogramLayout, lvs ...string) prometheus.Observer {
+	layoutKey := layout.key()
+	seriesKey := strings.Join(lvs, "\xff")
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	vec, exists := hs.vecs[layoutKey]
+	if !exists {
+		opts := hs.opts
+		layout.apply(&opts)
+		vec = prometheus.NewHistogramVec(opts, hs.labels)
+		hs.vecs[layoutKey] = vec
+	}
+
+	if previous, tracked := hs.series[seriesKey]; tracked && previous != layoutKey {
+		hs.vecs[previous].DeleteLabelValues(lvs...)
+	}
+	hs.series[seriesKey] = layoutKey
+
+	return vec.WithLabelValues(lvs...)
+}
+
+// Describe sends no descriptors, layouts are only known once observed,
+// which makes the set an unchecked collector
+func (hs *histogramSet) Describe(chan<- *prometheus.Desc) {}
+
+func (hs *histogramSet) Collect(ch chan<- prometheus.Metric) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	for _, vec := range hs.vecs {
+		vec.Collect(ch)
+	}
+}
+
+// DeleteLabelValues deletes the series from whichever layout it lives in
+func (hs *histogramSet) DeleteLabelValues(lvs ...string) bool {
+	seriesKey := strings.Join(lvs, "\xff")
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	layout, tracked := hs.series[seriesKey]
+	if !tracked {
+		return false
+	}
+	delete(hs.series, seriesKey)
+	return hs.vecs[layout].DeleteLabelValues(lvs...)
+}
 
-func updateMetrics(entry *traefikLogConfig, urlPatterns []URLPattern) {
+func (hs *histogramSet) Reset() {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	for _, vec := range hs.vecs {
+		vec.Reset()
+	}
+	hs.series = make(map[string]string)
+}
+
+func updateMetrics(entry *traefikLogConfig, config *TraefikOfficerConfig) {
 	method := entry.RequestMethod
-	code := strconv.Itoa(entry.OriginStatus)
-	service := entry.RouterName
+	status := entry.Status()
+	code := strconv.Itoa(status)
+	service := entry.Router.ServiceKey()
 	duration := float64(entry.Duration) / 1000.0 // Convert to seconds
 
 	// Original metrics (keeping existing functionality)
 	totalRequests.WithLabelValues(method, code, service).Inc()
-	requestDuration.WithLabelValues(method, code, service).Observe(duration)
+	requestDuration.WithLabelValues(config.LatencyHistogramFor(service, ""), method, code, service).Observe(duration)
+	series.Touch("requests_total", totalRequests, method, code, service)
+	series.Touch("request_duration_seconds", requestDuration, method, code, service)
+	updateSourceMetrics(entry, service, code)
+	workloads.Observe(entry.Router, code, duration)
 
 	// New endpoint-specific metrics
-	endpoint := normalizeURL(service, entry.RequestPath, urlPatterns)
+	endpoint := normalizeURL(entry.Router, method, entry.RequestPath, config)
+	endpoint = endpointGuard.Admit(service, endpoint, config.MaxEndpointsFor(service))
 
 	key := fmt.Sprintf("%s:%s", service, endpoint)
-	endpointStatsMutex.RLock()
-	if endpointStats[key] == nil {
-		endpointStatsMutex.RUnlock()
-		endpointStatsMutex.Lock()
-		endpointStats[key] = &EndpointStat{}
-		endpointStatsMutex.Unlock()
-	} else {
-		endpointStatsMutex.RUnlock()
-	}
-	endpointStatsMutex.RLock()
-	stat := endpointStats[key]
-	endpointStatsMutex.RUnlock()
 
-	endpointStatsMutex.Lock()
+	// The stat is updated under its own lock, so the sketch work does not hold
+	// up other endpoints. A stat an expiry or a collapse removed in between is
+	// retired, and endpointStatFor looks up the one in its place instead.
+	stat := endpointStatFor(key, config.Windows())
 	stat.TotalRequests++
 	stat.TotalDuration += duration
 
 	if duration > stat.MaxDuration {
 		stat.MaxDuration = duration
 	}
-	endpointStatsMutex.Unlock()
-
-	isError := entry.OriginStatus >= 400
-	if isError {
-		endpointStatsMutex.Lock()
+	stat.observe(time.Now(), requestObservation{
+		duration:       duration,
+		status:         status,
+		apdexThreshold: config.ApdexThresholdFor(service, endpoint),
+		responseSize:   int64(entry.OriginContentSize),
+		detailed:       entry.fromJSON,
+		overhead:       entry.Overhead / 1000.0,
+		retryAttempts:  entry.RetryAttempts,
+	})
+	if status >= 400 {
 		stat.ErrorCount++
-		endpointStatsMutex.Unlock()
-		errorRate := float64(stat.ErrorCount) / float64(stat.TotalRequests)
-		endpointErrorRate.WithLabelValues(service, endpoint).Set(errorRate)
-		if entry.OriginStatus >= 500 {
-			endpointStatsMutex.Lock()
+		if status >= 500 {
 			stat.ServerErrorCount++
-			endpointStatsMutex.Unlock()
-			serverErrorRate := float64(stat.ServerErrorCount) / float64(stat.TotalRequests)
-			endpointServerErrorRate.WithLabelValues(service, endpoint).Set(serverErrorRate)
 		} else {
-			endpointStatsMutex.Lock()
 			stat.ClientErrorCount++
-			endpointStatsMutex.Unlock()
-			clientErrorRate := float64(stat.ClientErrorCount) / float64(stat.TotalRequests)
-			endpointClientErrorRate.WithLabelValues(service, endpoint).Set(clientErrorRate)
 		}
 	}
+	stat.mu.Unlock()
+
+	slos.Observe(config, service, endpoint, method, duration, status)
 
 	// Check if this is a top path for its service
 	topPathsMutex.RLock()
 	isTopPath := topPathsPerService[service][key]
 	topPathsMutex.RUnlock()
 
+	// Every request is counted exactly once, under its own path while it is a
+	// top path and under the service's other path otherwise, so the endpoint
+	// series always add up to traefik_officer_requests_total
+	pathLabel := otherEndpoint
 	if isTopPath {
-		avgLatency := stat.TotalDuration / float64(stat.TotalRequests)
-		endpointAvgLatency.WithLabelValues(service, endpoint).Set(avgLatency)
-		endpointMaxLatency.WithLabelValues(service, endpoint).Set(stat.MaxDuration)
-		endpointRequests.WithLabelValues(service, endpoint, method, code).Inc()
-		endpointDuration.WithLabelValues(service, endpoint, method, code).Observe(duration)
+		pathLabel = endpoint
 	}
-}
-
-func clearAllPathMetrics() {
-	// Clear latency metrics
-	endpointAvgLatency.Reset()
-	endpointMaxLatency.Reset()
-	endpointDuration.Reset()
-	endpointRequests.Reset()
-}
-
-func startMetricsCleaner(interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	go func() {
-		for range ticker.C {
-			clearAllPathMetrics()
-		}
-	}()
+	concurrency.Observe(entry, config, service, key, isTopPath)
+	endpointRequests.WithLabelValues(service, pathLabel, method, code).Inc()
+	endpointDuration.WithLabelValues(config.LatencyHistogramFor(service, pathLabel), service, pathLabel, method, code).Observe(duration)
+	series.Touch("endpoint_requests_total", endpointRequests, service, pathLabel, method, code)
+	series.Touch("endpoint_request_duration_seconds", endpointDuration, service, pathLabel, method, code)
+	updateSizeMetrics(entry, config, service, pathLabel)
+	updateTimingMetrics(entry, config, service, pathLabel)
+	updateRetryMetrics(entry, service, pathLabel)
+	updateBackendMetrics(entry, config, service, status)
+	topTalkers.Observe(entry, config, status)
 }
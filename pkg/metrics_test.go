@@ -0,0 +1,50 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestUpdateMetricsEndpointStats(t *testing.T) {
+	config := &TraefikOfficerConfig{}
+	config.compile()
+	router := RouterInfo{Name: "stats-test-front-1234@kubernetescrd", Provider: providerKubernetesCRD, Namespace: "stats-test", Resource: "front"}
+	key := router.ServiceKey() + ":/health"
+	t.Cleanup(func() {
+		endpointStatsMutex.Lock()
+		delete(endpointStats, key)
+		endpointStatsMutex.Unlock()
+		endpointGuard.Forget(router.ServiceKey(), "/health")
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(status int) {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				updateMetrics(&traefikLogConfig{
+					RequestMethod: "GET",
+					RequestPath:   "/health",
+					OriginStatus:  status,
+					Duration:      20,
+					Router:        router,
+				}, config)
+			}
+		}(200 + 300*(i%2))
+	}
+	wg.Wait()
+
+	endpointStatsMutex.RLock()
+	stat := endpointStats[key]
+	endpointStatsMutex.RUnlock()
+	if stat == nil {
+		t.Fatalf("no stats for %s", key)
+	}
+	if stat.TotalRequests != 200 || stat.ErrorCount != 100 || stat.ServerErrorCount != 100 {
+		t.Errorf("stats = %d requests, %d errors, %d server errors, want 200, 100, 100", stat.TotalRequests, stat.ErrorCount, stat.ServerErrorCount)
+	}
+	if stat.MaxDuration != 0.02 {
+		t.Errorf("MaxDuration = %v, want 0.02", stat.MaxDuration)
+	}
+}
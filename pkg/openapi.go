@@ -0,0 +1,416 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	logger "github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// undocumentedEndpoint is the endpoint label of requests the service's spec does not describe
+	undocumentedEndpoint = "{undocumented}"
+
+	// otherMethod is the method label of requests with a method HTTP does not define
+	otherMethod = "OTHER"
+
+	openAPIFetchTimeout = 10 * time.Second
+	// openAPIRefreshInterval is how often loaded specs are checked for changes
+	openAPIRefreshInterval = time.Minute
+	// openAPIRetryMin and openAPIRetryMax bound the backoff between failed loads
+	openAPIRetryMin = 5 * time.Second
+	openAPIRetryMax = 5 * time.Minute
+)
+
+var (
+	openAPIUndocumentedRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "traefik_officer_openapi_undocumented_requests_total",
+			Help: "Requests to services with an OpenAPI spec that match no documented path (reason=path) or method (reason=method), unknown methods are counted as OTHER",
+		},
+		[]string{"service", "method", "reason"},
+	)
+
+	openAPIHTTPMethods = map[string]bool{
+		"get": true, "put": true, "post": true, "delete": true,
+		"options": true, "head": true, "patch": true, "trace": true,
+	}
+
+	openAPITemplateParam = regexp.MustCompile(`\{[^{}/]+\}`)
+
+	openAPISpecs = &openAPISpecCache{sources: make(map[string]*openAPISource)}
+)
+
+// openAPIDocument is the part of an OpenAPI 3 document used for normalization
+type openAPIDocument struct {
+	Servers []struct {
+		URL string `json:"url"`
+	} `json:"servers"`
+	Paths map[string]map[string]json.RawMessage `json:"paths"`
+}
+
+// openAPISegment matches one path segment of a template
+type openAPISegment struct {
+	literal string
+	regex   *regexp.Regexp // nil for literal segments
+	whole   bool           // the segment is a single parameter such as {id}
+}
+
+// rank orders segments for matching: literals before partial templates before parameters
+func (s openAPISegment) rank() int {
+	switch {
+	case s.regex == nil:
+		return 2
+	case !s.whole:
+		return 1
+	}
+	return 0
+}
+
+func (s openAPISegment) matches(value string) bool {
+	if s.regex == nil {
+		return s.literal == value
+	}
+	return s.regex.MatchString(value)
+}
+
+// openAPIRoute is one documented path with the methods it supports
+type openAPIRoute struct {
+	template string
+	segments []openAPISegment
+	methods  map[string]bool
+}
+
+// openAPISpec matches request paths against the templates of a spec
+type openAPISpec struct {
+	location string
+	routes   map[int][]*openAPIRoute // by segment count, most specific first
+}
+
+// openAPISpecCache loads each spec location once and keeps it up to date in
+// the background, so config rebuilds only look specs up
+type openAPISpecCache struct {
+	mu      sync.Mutex
+	sources map[string]*openAPISource
+}
+
+// Get returns the source of the spec at a file path or http(s) URL without
+// blocking. The spec is loaded in the background and is nil until then.
+func (c *openAPISpecCache) Get(location string) *openAPISource {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if source, exists := c.sources[location]; exists {
+		return source
+	}
+	source := &openAPISource{location: location, stop: make(chan struct{})}
+	c.sources[location] = source
+	go source.run()
+	return source
+}
+
+// Retain stops loading the specs at locations that are no longer configured
+func (c *openAPISpecCache) Retain(locations map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for location, source := range c.sources {
+		if !locations[location] {
+			close(source.stop)
+			delete(c.sources, location)
+			logger.Debugf("Stopped loading OpenAPI spec %s, it is no longer configured", location)
+		}
+	}
+}
+
+// openAPISource is a spec location and the spec last loaded from it
+type openAPISource struct {
+	location string
+	spec     atomic.Pointer[openAPISpec]
+	stop     chan struct{} // closed when the location is no longer configured
+
+	// What the loaded spec was read from: mtime for files, ETag or Last-Modified for URLs
+	modTime      time.Time
+	etag         string
+	lastModified string
+}
+
+// Spec returns the loaded spec, or nil if it has not been loaded yet
+func (s *openAPISource) Spec() *openAPISpec {
+	if s == nil {
+		return nil
+	}
+	return s.spec.Load()
+}
+
+// run loads the spec, retrying failures with a backoff, then checks it for
+// changes periodically until stopped
+func (s *openAPISource) run() {
+	retry := openAPIRetryMin
+	for {
+		wait := openAPIRefreshInterval
+		changed, err := s.refresh()
+		switch {
+		case err != nil && s.Spec() == nil:
+			logger.Warnf("Failed to load OpenAPI spec %s: %v - the service will use the default normalization, retrying in %s", s.location, err, retry)
+		case err != nil:
+			logger.Warnf("Failed to refresh OpenAPI spec %s: %v - keeping the loaded one, retrying in %s", s.location, err, retry)
+		case changed:
+			logger.Infof("Loaded OpenAPI spec %s", s.location)
+		}
+		if err != nil {
+			wait = retry
+			retry = min(2*retry, openAPIRetryMax)
+		} else {
+			retry = openAPIRetryMin
+		}
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// refresh loads the spec if it changed since the last load and reports whether it did
+func (s *openAPISource) refresh() (bool, error) {
+	if strings.HasPrefix(s.location, "http://") || strings.HasPrefix(s.location, "https://") {
+		return s.refreshURL()
+	}
+
+	info, err := os.Stat(s.location)
+	if err != nil {
+		return false, err
+	}
+	if s.Spec() != nil && info.ModTime().Equal(s.modTime) {
+		return false, nil
+	}
+	data, err := os.ReadFile(s.location)
+	if err != nil {
+		return false, err
+	}
+	spec, err := parseOpenAPISpec(s.location, data)
+	if err != nil {
+		return false, err
+	}
+	s.modTime = info.ModTime()
+	s.spec.Store(spec)
+	return true, nil
+}
+
+func (s *openAPISource) refreshURL() (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, s.location, nil)
+	if err != nil {
+		return false, err
+	}
+	if s.Spec() != nil {
+		if s.etag != "" {
+			req.Header.Set("If-None-Match", s.etag)
+		}
+		if s.lastModified != "" {
+			req.Header.Set("If-Modified-Since", s.lastModified)
+		}
+	}
+
+	client := &http.Client{Timeout: openAPIFetchTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			logger.Warnf("Error closing response body: %v", err)
+		}
+	}()
+	switch {
+	case resp.StatusCode == http.StatusNotModified && s.Spec() != nil:
+		return false, nil
+	case resp.StatusCode != http.StatusOK:
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	spec, err := parseOpenAPISpec(s.location, data)
+	if err != nil {
+		return false, err
+	}
+	s.etag, s.lastModified = resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	s.spec.Store(spec)
+	return true, nil
+}
+
+func parseOpenAPISpec(location string, data []byte) (*openAPISpec, error) {
+	// YAML is a superset of JSON, so both formats go through the same conversion
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse spec: %w", err)
+	}
+	var doc openAPIDocument
+	if err := json.Unmarshal(jsonData, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse spec: %w", err)
+	}
+	if len(doc.Paths) == 0 {
+		return nil, fmt.Errorf("spec has no paths")
+	}
+	return compileOpenAPISpec(location, doc), nil
+}
+
+// compileOpenAPISpec builds a route per documented path and server base path
+func compileOpenAPISpec(location string, doc openAPIDocument) *openAPISpec {
+	basePaths := make([]string, 0, len(doc.Servers))
+	for _, server := range doc.Servers {
+		basePaths = appendUnique(basePaths, openAPIBasePath(server.URL))
+	}
+	if len(basePaths) == 0 {
+		basePaths = append(basePaths, "")
+	}
+
+	spec := &openAPISpec{location: location, routes: make(map[int][]*openAPIRoute)}
+	for path, item := range doc.Paths {
+		methods := make(map[string]bool)
+		for key := range item {
+			if openAPIHTTPMethods[strings.ToLower(key)] {
+				methods[strings.ToUpper(key)] = true
+			}
+		}
+		if len(methods) == 0 {
+			continue
+		}
+
+		for _, base := range basePaths {
+			template := base + "/" + strings.Trim(path, "/")
+			if template != "/" {
+				template = strings.TrimSuffix(template, "/")
+			}
+			route := &openAPIRoute{template: template, methods: methods}
+			for _, segment := range splitPathSegments(template) {
+				route.segments = append(route.segments, compileOpenAPISegment(segment))
+			}
+			spec.routes[len(route.segments)] = append(spec.routes[len(route.segments)], route)
+		}
+	}
+
+	for _, routes := range spec.routes {
+		sort.SliceStable(routes, func(i, j int) bool {
+			for k := range routes[i].segments {
+				ri, rj := routes[i].segments[k].rank(), routes[j].segments[k].rank()
+				if ri != rj {
+					return ri > rj
+				}
+			}
+			return routes[i].template < routes[j].template
+		})
+	}
+	return spec
+}
+
+// openAPIBasePath returns the path of a server URL, which may be relative
+func openAPIBasePath(serverURL string) string {
+	path := serverURL
+	if parsed, err := url.Parse(serverURL); err == nil && parsed.Host != "" {
+		path = parsed.Path
+	} else if idx := strings.Index(serverURL, "://"); idx != -1 {
+		// Server variables in the host make the URL unparsable
+		path = ""
+		if slash := strings.Index(serverURL[idx+3:], "/"); slash != -1 {
+			path = serverURL[idx+3+slash:]
+		}
+	}
+	path = strings.TrimRight(path, "/")
+	if path != "" && !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+func compileOpenAPISegment(segment string) openAPISegment {
+	if !openAPITemplateParam.MatchString(segment) {
+		return openAPISegment{literal: segment}
+	}
+	if openAPITemplateParam.FindString(segment) == segment {
+		return openAPISegment{literal: segment, regex: regexp.MustCompile(`^.+$`), whole: true}
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	last := 0
+	for _, loc := range openAPITemplateParam.FindAllStringIndex(segment, -1) {
+		expr.WriteString(regexp.QuoteMeta(segment[last:loc[0]]))
+		expr.WriteString(`.+?`)
+		last = loc[1]
+	}
+	expr.WriteString(regexp.QuoteMeta(segment[last:]))
+	expr.WriteString("$")
+	return openAPISegment{literal: segment, regex: regexp.MustCompile(expr.String())}
+}
+
+func splitPathSegments(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// Match returns the template of the most specific documented path for the request.
+// The reason is "path" or "method" when the request is undocumented.
+func (s *openAPISpec) Match(method, path string) (string, string, bool) {
+	segments := splitPathSegments(path)
+
+	pathFound := false
+	for _, route := range s.routes[len(segments)] {
+		if !route.matches(segments) {
+			continue
+		}
+		if route.methods[method] || (method == http.MethodHead && route.methods[http.MethodGet]) {
+			return route.template, "", true
+		}
+		pathFound = true
+	}
+	if pathFound {
+		return "", "method", false
+	}
+	return "", "path", false
+}
+
+func (r *openAPIRoute) matches(segments []string) bool {
+	for i, segment := range r.segments {
+		if !segment.matches(segments[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeOpenAPI maps the request to its documented template, or to {undocumented}
+func normalizeOpenAPI(spec *openAPISpec, serviceName, method, path string) string {
+	pathPart, _, _ := strings.Cut(path, "?")
+	template, reason, found := spec.Match(strings.ToUpper(method), pathPart)
+	if !found {
+		// The method comes from the client, so only the ones HTTP defines become label values
+		methodLabel := strings.ToUpper(method)
+		if !openAPIHTTPMethods[strings.ToLower(method)] && methodLabel != http.MethodConnect {
+			methodLabel = otherMethod
+		}
+		openAPIUndocumentedRequests.WithLabelValues(serviceName, methodLabel, reason).Inc()
+		series.Touch("openapi_undocumented_requests_total", openAPIUndocumentedRequests, serviceName, methodLabel, reason)
+		return undocumentedEndpoint
+	}
+	return template
+}
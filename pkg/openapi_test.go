@@ -0,0 +1,190 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const testOpenAPISpec = `
+openapi: 3.0.0
+servers:
+  - url: https://api.example.com/v1
+paths:
+  /users/{id}:
+    get: {}
+  /users/me:
+    get: {}
+`
+
+func TestOpenAPISpecMatch(t *testing.T) {
+	spec, err := parseOpenAPISpec("test", []byte(testOpenAPISpec))
+	if err != nil {
+		t.Fatalf("parsing spec: %v", err)
+	}
+
+	tests := []struct {
+		method, path string
+		template     string
+		reason       string
+	}{
+		{method: "GET", path: "/v1/users/42", template: "/v1/users/{id}"},
+		{method: "GET", path: "/v1/users/me", template: "/v1/users/me"},
+		{method: "HEAD", path: "/v1/users/42", template: "/v1/users/{id}"},
+		{method: "POST", path: "/v1/users/42", reason: "method"},
+		{method: "GET", path: "/v1/orders", reason: "path"},
+	}
+	for _, tt := range tests {
+		template, reason, _ := spec.Match(tt.method, tt.path)
+		if template != tt.template || reason != tt.reason {
+			t.Errorf("Match(%s %s) = %q, %q, want %q, %q", tt.method, tt.path, template, reason, tt.template, tt.reason)
+		}
+	}
+}
+
+func TestNormalizeOpenAPIMethodLabel(t *testing.T) {
+	spec, err := parseOpenAPISpec("test", []byte(testOpenAPISpec))
+	if err != nil {
+		t.Fatalf("parsing spec: %v", err)
+	}
+
+	normalizeOpenAPI(spec, "openapi-test", "GARBAGE", "/v1/users/42")
+	normalizeOpenAPI(spec, "openapi-test", "delete", "/v1/users/42")
+
+	if got := testutil.ToFloat64(openAPIUndocumentedRequests.WithLabelValues("openapi-test", otherMethod, "method")); got != 1 {
+		t.Errorf("OTHER requests = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(openAPIUndocumentedRequests.WithLabelValues("openapi-test", "DELETE", "method")); got != 1 {
+		t.Errorf("DELETE requests = %v, want 1", got)
+	}
+	if openAPIUndocumentedRequests.DeleteLabelValues("openapi-test", "GARBAGE", "method") {
+		t.Error("a series was created for an unknown method")
+	}
+}
+
+func TestOpenAPISourceRefreshURL(t *testing.T) {
+	var fetches, notModified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(testOpenAPISpec))
+	}))
+	defer server.Close()
+
+	source := &openAPISource{location: server.URL + "/openapi.yaml"}
+	if changed, err := source.refresh(); err != nil || !changed {
+		t.Fatalf("first refresh = %t, %v, want a loaded spec", changed, err)
+	}
+	if changed, err := source.refresh(); err != nil || changed {
+		t.Fatalf("second refresh = %t, %v, want an unchanged spec", changed, err)
+	}
+	if fetches.Load() != 2 || notModified.Load() != 1 {
+		t.Errorf("fetches = %d, not modified = %d, want 2 and 1", fetches.Load(), notModified.Load())
+	}
+	if source.Spec() == nil {
+		t.Error("spec was dropped by a not modified response")
+	}
+}
+
+func TestOpenAPISourceRefreshFile(t *testing.T) {
+	location := filepath.Join(t.TempDir(), "openapi.yaml")
+	source := &openAPISource{location: location}
+	if _, err := source.refresh(); err == nil {
+		t.Fatal("refresh of a missing file succeeded")
+	}
+
+	if err := os.WriteFile(location, []byte(testOpenAPISpec), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := source.refresh(); err != nil || !changed {
+		t.Fatalf("refresh = %t, %v, want a loaded spec", changed, err)
+	}
+	if changed, _ := source.refresh(); changed {
+		t.Error("unchanged file was reloaded")
+	}
+
+	edited := testOpenAPISpec + "  /orders:\n    get: {}\n"
+	if err := os.WriteFile(location, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(location, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := source.refresh(); err != nil || !changed {
+		t.Fatalf("refresh after edit = %t, %v, want a reloaded spec", changed, err)
+	}
+	if _, _, found := source.Spec().Match("GET", "/v1/orders"); !found {
+		t.Error("edited spec was not picked up")
+	}
+}
+
+func TestOpenAPISpecCacheGetDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		_, _ = w.Write([]byte(testOpenAPISpec))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	cache := &openAPISpecCache{sources: make(map[string]*openAPISource)}
+	defer cache.Retain(nil)
+	start := time.Now()
+	source := cache.Get(server.URL)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Get took %s, want it not to wait for the fetch", elapsed)
+	}
+	if source.Spec() != nil {
+		t.Error("spec available before it was served")
+	}
+	if cache.Get(server.URL) != source {
+		t.Error("second Get returned a different source")
+	}
+}
+
+func TestOpenAPISpecCacheRetain(t *testing.T) {
+	dir := t.TempDir()
+	kept, dropped := filepath.Join(dir, "kept.yaml"), filepath.Join(dir, "dropped.yaml")
+	cache := &openAPISpecCache{sources: make(map[string]*openAPISource)}
+	keptSource, droppedSource := cache.Get(kept), cache.Get(dropped)
+	defer cache.Retain(nil)
+
+	cache.Retain(map[string]bool{kept: true})
+	select {
+	case <-droppedSource.stop:
+	default:
+		t.Error("dropped location was not stopped")
+	}
+	select {
+	case <-keptSource.stop:
+		t.Error("kept location was stopped")
+	default:
+	}
+	if cache.Get(kept) != keptSource || cache.Get(dropped) == droppedSource {
+		t.Error("Retain did not evict only the dropped location")
+	}
+
+	// A stopped source leaves its retry loop
+	done := make(chan struct{})
+	go func() {
+		droppedSource.run()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("run did not return after the source was stopped")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// Top N ranking criteria, see TopNRanking in the README
+const (
+	rankByAvgLatency = "avg_latency"
+	rankByRequests   = "requests"
+	rankByErrors     = "errors"
+	rankByErrorRate  = "error_rate"
+	rankByP99Latency = "p99_latency"
+	rankByTotalTime  = "total_time"
+
+	defaultTopNMinRequests = 10
+)
+
+// rankingCriteria score an endpoint's recent window. Endpoints scoring zero
+// are not ranked by that criterion.
+var rankingCriteria = map[string]func(summary windowSummary, minRequests int64) float64{
+	rankByAvgLatency: func(s windowSummary, _ int64) float64 { return s.AvgLatency() },
+	rankByRequests:   func(s windowSummary, _ int64) float64 { return float64(s.Requests) },
+	rankByErrors:     func(s windowSummary, _ int64) float64 { return float64(s.Errors) },
+	rankByErrorRate: func(s windowSummary, minRequests int64) float64 {
+		// A single failed request to a quiet endpoint is not a 100% error rate worth exporting
+		if s.Requests < minRequests {
+			return 0
+		}
+		return s.ErrorRate()
+	},
+	rankByP99Latency: func(s windowSummary, _ int64) float64 { return s.Quantile(0.99) },
+	rankByTotalTime:  func(s windowSummary, _ int64) float64 { return s.TotalDuration },
+}
+
+// validRankingCriteria returns the known criteria of the list, and the unknown ones
+func validRankingCriteria(criteria []string) ([]string, []string) {
+	var valid, unknown []string
+	for _, criterion := range criteria {
+		criterion = strings.ToLower(strings.TrimSpace(criterion))
+		if _, known := rankingCriteria[criterion]; known {
+			valid = appendUnique(valid, criterion)
+		} else {
+			unknown = append(unknown, criterion)
+		}
+	}
+	return valid, unknown
+}
+
+// rankedEndpoint is an endpoint and its recent window
+type rankedEndpoint struct {
+	path    string
+	summary windowSummary
+}
+
+// topEndpoints returns the union of the top limit endpoints by each criterion
+func topEndpoints(endpoints []rankedEndpoint, criteria []string, limit int, minRequests int64) []string {
+	selected := make(map[string]bool)
+	var result []string
+
+	scores := make([]float64, len(endpoints))
+	order := make([]int, len(endpoints))
+	for _, criterion := range criteria {
+		score := rankingCriteria[criterion]
+		for i := range endpoints {
+			scores[i] = score(endpoints[i].summary, minRequests)
+			order[i] = i
+		}
+		sort.Slice(order, func(a, b int) bool {
+			if scores[order[a]] != scores[order[b]] {
+				return scores[order[a]] > scores[order[b]]
+			}
+			return endpoints[order[a]].path < endpoints[order[b]].path
+		})
+
+		for rank := 0; rank < limit && rank < len(order); rank++ {
+			i := order[rank]
+			if scores[i] <= 0 {
+				break
+			}
+			if !selected[endpoints[i].path] {
+				selected[endpoints[i].path] = true
+				result = append(result, endpoints[i].path)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// rankedSummary is an endpoint that served requests of the given latency, of
+// which errors failed
+func rankedSummary(path string, requests, errors int64, latency float64) rankedEndpoint {
+	summary := windowSummary{Requests: requests, Errors: errors, TotalDuration: float64(requests) * latency, sketch: newDDSketch()}
+	for i := int64(0); i < requests; i++ {
+		summary.sketch.Add(latency)
+	}
+	return rankedEndpoint{path: path, summary: summary}
+}
+
+func TestTopEndpoints(t *testing.T) {
+	endpoints := []rankedEndpoint{
+		rankedSummary("/hot", 1000, 5, 0.01),
+		rankedSummary("/admin/report", 3, 0, 4),
+		rankedSummary("/flaky", 50, 25, 0.05),
+		rankedSummary("/rare-failure", 2, 2, 0.02),
+		rankedSummary("/search", 200, 10, 0.3),
+		rankedSummary("/idle", 0, 0, 0),
+	}
+
+	tests := []struct {
+		name        string
+		criteria    []string
+		limit       int
+		minRequests int64
+		want        []string
+	}{
+		{name: "average latency", criteria: []string{rankByAvgLatency}, limit: 2, want: []string{"/admin/report", "/search"}},
+		{name: "requests", criteria: []string{rankByRequests}, limit: 2, want: []string{"/hot", "/search"}},
+		{name: "errors", criteria: []string{rankByErrors}, limit: 2, want: []string{"/flaky", "/search"}},
+		{name: "error rate with minimum volume", criteria: []string{rankByErrorRate}, limit: 2, minRequests: 10, want: []string{"/flaky", "/search"}},
+		{name: "error rate without minimum volume", criteria: []string{rankByErrorRate}, limit: 2, minRequests: 1, want: []string{"/rare-failure", "/flaky"}},
+		{name: "p99 latency", criteria: []string{rankByP99Latency}, limit: 1, want: []string{"/admin/report"}},
+		{name: "total time", criteria: []string{rankByTotalTime}, limit: 2, want: []string{"/search", "/admin/report"}},
+		{name: "union of criteria", criteria: []string{rankByRequests, rankByAvgLatency}, limit: 1, want: []string{"/hot", "/admin/report"}},
+		{name: "union without duplicates", criteria: []string{rankByRequests, rankByTotalTime, rankByErrors}, limit: 2, want: []string{"/hot", "/search", "/admin/report", "/flaky"}},
+		{name: "endpoints scoring zero are left out", criteria: []string{rankByErrors}, limit: 10, want: []string{"/flaky", "/search", "/hot", "/rare-failure"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := topEndpoints(endpoints, tt.criteria, tt.limit, tt.minRequests)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("topEndpoints(%v, %d) = %v, want %v", tt.criteria, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidRankingCriteria(t *testing.T) {
+	valid, unknown := validRankingCriteria([]string{" Requests", "error_rate", "requests", "latency"})
+	if !reflect.DeepEqual(valid, []string{rankByRequests, rankByErrorRate}) {
+		t.Errorf("valid = %v, want [requests error_rate]", valid)
+	}
+	if !reflect.DeepEqual(unknown, []string{"latency"}) {
+		t.Errorf("unknown = %v, want [latency]", unknown)
+	}
+}
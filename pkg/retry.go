@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	retriedRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "traefik_officer_retried_requests_total",
+			Help: "Total number of HTTP requests Traefik retried at least once, JSON logs only",
+		},
+		[]string{"app"},
+	)
+
+	endpointRetriedRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "traefik_officer_endpoint_retried_requests_total",
+			Help: "Total number of HTTP requests per endpoint Traefik retried at least once, JSON logs only",
+		},
+		[]string{"app", "request_path"},
+	)
+
+	retryAttempts = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "traefik_officer_retry_attempts",
+			Help:    "Retry attempts per HTTP request, JSON logs only",
+			Buckets: []float64{0, 1, 2, 3, 5, 10},
+		},
+		[]string{"app"},
+	)
+)
+
+// updateRetryMetrics records the retries of a request. pathLabel is the
+// request_path label the request is counted under.
+func updateRetryMetrics(entry *traefikLogConfig, service, pathLabel string) {
+	// Only JSON logs carry the retry attempts
+	if !entry.fromJSON {
+		return
+	}
+
+	retryAttempts.WithLabelValues(service).Observe(float64(entry.RetryAttempts))
+	series.Touch("retry_attempts", retryAttempts, service)
+	if entry.RetryAttempts == 0 {
+		return
+	}
+	retriedRequests.WithLabelValues(service).Inc()
+	endpointRetriedRequests.WithLabelValues(service, pathLabel).Inc()
+	series.Touch("retried_requests_total", retriedRequests, service)
+	series.Touch("endpoint_retried_requests_total", endpointRetriedRequests, service, pathLabel)
+}
+
+// RetriedSuccessRatio is the share of successful responses with known retry
+// attempts that needed at least one retry
+func (s windowSummary) RetriedSuccessRatio() float64 {
+	if s.DetailedSuccesses == 0 {
+		return 0
+	}
+	return float64(s.RetriedSuccesses) / float64(s.DetailedSuccesses)
+}
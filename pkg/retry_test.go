@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestUpdateRetryMetrics(t *testing.T) {
+	tests := []struct {
+		name         string
+		service      string
+		entry        traefikLogConfig
+		wantAttempts uint64
+		wantRetried  float64
+	}{
+		{name: "common log format has no retries", service: "retry-test-clf", entry: traefikLogConfig{RetryAttempts: 2}},
+		{name: "no retry", service: "retry-test-none", entry: traefikLogConfig{fromJSON: true}, wantAttempts: 1},
+		{name: "retried", service: "retry-test-retried", entry: traefikLogConfig{RetryAttempts: 2, fromJSON: true}, wantAttempts: 1, wantRetried: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(func() {
+				retryAttempts.DeleteLabelValues(tt.service)
+				retriedRequests.DeleteLabelValues(tt.service)
+				endpointRetriedRequests.DeleteLabelValues(tt.service, "/pay")
+			})
+			updateRetryMetrics(&tt.entry, tt.service, "/pay")
+
+			if count, sum := histogramSample(t, retryAttempts, tt.service); count != tt.wantAttempts || sum != float64(tt.wantAttempts)*float64(tt.entry.RetryAttempts) {
+				t.Errorf("retry attempts = %d summing to %v, want %d", count, sum, tt.wantAttempts)
+			}
+			if got := testutil.ToFloat64(retriedRequests.WithLabelValues(tt.service)); got != tt.wantRetried {
+				t.Errorf("retried requests = %v, want %v", got, tt.wantRetried)
+			}
+			if got := testutil.ToFloat64(endpointRetriedRequests.WithLabelValues(tt.service, "/pay")); got != tt.wantRetried {
+				t.Errorf("endpoint retried requests = %v, want %v", got, tt.wantRetried)
+			}
+		})
+	}
+}
+
+func TestRetriedSuccessRatio(t *testing.T) {
+	tests := []struct {
+		name         string
+		observations []requestObservation
+		want         float64
+	}{
+		{name: "no detailed requests", observations: []requestObservation{{status: 200, retryAttempts: 1}}, want: 0},
+		{name: "errors are left out", observations: []requestObservation{
+			{status: 200, detailed: true},
+			{status: 200, detailed: true, retryAttempts: 1},
+			{status: 502, detailed: true, retryAttempts: 3},
+			{status: 200, retryAttempts: 1},
+		}, want: 0.5},
+		{name: "every success retried", observations: []requestObservation{
+			{status: 201, detailed: true, retryAttempts: 1},
+			{status: 204, detailed: true, retryAttempts: 2},
+		}, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newSlidingWindow(rankingWindow, windowSlots)
+			now := time.Now()
+			for _, obs := range tt.observations {
+				w.Observe(now, obs)
+			}
+			if got := w.Summary(now).RetriedSuccessRatio(); got != tt.want {
+				t.Errorf("RetriedSuccessRatio() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Traefik provider names as they appear after the @ in router and service names
+const (
+	providerKubernetesCRD     = "kubernetescrd"
+	providerKubernetesIngress = "kubernetes"
+	providerInternal          = "internal"
+)
+
+// How the part of a Kubernetes name after namespace-name is treated
+const (
+	kubernetesNameExact  = iota // nothing follows, e.g. kubernetescrd routers once the hash is removed
+	kubernetesNamePort          // an optional port follows, e.g. kubernetescrd services
+	kubernetesNamePrefix        // anything may follow, e.g. host and path of kubernetes ingress routers
+)
+
+// maxRouterNameCacheSize bounds the parsed names kept, the cache starts over once it is full
+const maxRouterNameCacheSize = 10000
+
+var (
+	// kubernetescrd routers end with the first 10 bytes of a sha256 of the route match rule
+	crdRouterHashSuffix = regexp.MustCompile(`-[0-9a-f]{20}$`)
+	// kubernetescrd services generated from a Kubernetes Service end with the port
+	crdServicePortSuffix = regexp.MustCompile(`-\d+$`)
+	// Entry point redirections are named <entrypoint>-to-<entrypoint>@internal
+	internalRedirectRouter = regexp.MustCompile(`^([A-Za-z0-9]+)-to-[A-Za-z0-9]+$`)
+
+	routerNames = newRouterNameParser()
+)
+
+// RouterInfo holds the parts of a Traefik router or service name
+type RouterInfo struct {
+	Name       string `json:"name"`
+	Provider   string `json:"provider"`
+	Namespace  string `json:"namespace,omitempty"`
+	Resource   string `json:"resource"`
+	EntryPoint string `json:"entrypoint,omitempty"`
+}
+
+// ServiceKey returns the namespace-resource name used to identify the service in config and labels
+func (ri RouterInfo) ServiceKey() string {
+	return BuildServiceName(ri.Namespace, ri.Resource, "-")
+}
+
+// Matches reports whether the router belongs to the given configured service.
+// An empty Name matches every resource in the namespace and an empty Provider matches any provider.
+func (ri RouterInfo) Matches(service TraefikService) bool {
+	if service.Provider != "" && service.Provider != ri.Provider {
+		return false
+	}
+	if normalizeTraefikName(service.Namespace) != ri.Namespace {
+		return false
+	}
+	return service.Name == "" || normalizeTraefikName(service.Name) == ri.Resource
+}
+
+// routerNameParser splits Traefik router and service names into their parts.
+// Kubernetes names join namespace and resource with dashes, so known services
+// are used to find where one ends and the other starts.
+type routerNameParser struct {
+	mu          sync.RWMutex
+	sources     map[string][]TraefikService      // known services by where they came from
+	routers     map[string]map[string]RouterInfo // exact router names by where they came from
+	known       []TraefikService                 // merged and normalized, longest key first
+	namespaces  []string                         // normalized, longest first
+	entryPoints []string
+	cache       map[string]RouterInfo
+}
+
+func newRouterNameParser() *routerNameParser {
+	return &routerNameParser{
+		sources: make(map[string][]TraefikService),
+		routers: make(map[string]map[string]RouterInfo),
+		cache:   make(map[string]RouterInfo),
+	}
+}
+
+// SetKnownServices replaces the services from one source (config, discovery, ...)
+// used to split Kubernetes names
+func (p *routerNameParser) SetKnownServices(source string, services []TraefikService) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sources[source] = services
+	p.rebuild()
+}
+
+// SetKnownRouters replaces the exact router names from one source. These are
+// returned as is and take precedence over parsing.
+func (p *routerNameParser) SetKnownRouters(source string, routers map[string]RouterInfo) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.routers[source] = routers
+	p.cache = make(map[string]RouterInfo)
+}
+
+// rebuild merges the known services of all sources. The caller must hold mu.
+func (p *routerNameParser) rebuild() {
+	seen := make(map[string]bool)
+	known := make([]TraefikService, 0)
+	nsSet := make(map[string]bool)
+	for _, services := range p.sources {
+		for _, s := range services {
+			if s.Namespace == "" {
+				continue
+			}
+			ns := normalizeTraefikName(s.Namespace)
+			nsSet[ns] = true
+			if s.Name == "" {
+				continue
+			}
+			svc := TraefikService{Namespace: ns, Name: normalizeTraefikName(s.Name)}
+			key := BuildServiceName(svc.Namespace, svc.Name, "-")
+			if !seen[key] {
+				seen[key] = true
+				known = append(known, svc)
+			}
+		}
+	}
+	sort.SliceStable(known, func(i, j int) bool {
+		return len(BuildServiceName(known[i].Namespace, known[i].Name, "-")) >
+			len(BuildServiceName(known[j].Namespace, known[j].Name, "-"))
+	})
+
+	namespaces := make([]string, 0, len(nsSet))
+	for ns := range nsSet {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Slice(namespaces, func(i, j int) bool { return len(namespaces[i]) > len(namespaces[j]) })
+
+	p.known = known
+	p.namespaces = namespaces
+	p.cache = make(map[string]RouterInfo)
+}
+
+// SetEntryPoints sets the entry point names that may prefix router names
+func (p *routerNameParser) SetEntryPoints(entryPoints []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.entryPoints = entryPoints
+	p.cache = make(map[string]RouterInfo)
+}
+
+// Parse splits a router or service name such as ns-name-hash@kubernetescrd into its parts
+func (p *routerNameParser) Parse(name string) RouterInfo {
+	p.mu.RLock()
+	info, cached := p.cache[name]
+	p.mu.RUnlock()
+	if cached {
+		return info
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	info = p.parse(name)
+	if len(p.cache) >= maxRouterNameCacheSize {
+		p.cache = make(map[string]RouterInfo)
+	}
+	p.cache[name] = info
+	return info
+}
+
+func (p *routerNameParser) parse(name string) RouterInfo {
+	for _, routers := range p.routers {
+		if info, exists := routers[name]; exists {
+			info.Name = name
+			return info
+		}
+	}
+
+	info := RouterInfo{Name: name}
+
+	base := name
+	if idx := strings.LastIndex(name, "@"); idx != -1 {
+		base, info.Provider = name[:idx], name[idx+1:]
+	}
+
+	switch info.Provider {
+	case providerInternal:
+		info.Resource = base
+		if m := internalRedirectRouter.FindStringSubmatch(base); m != nil {
+			info.EntryPoint = m[1]
+		}
+	case providerKubernetesCRD:
+		if crdRouterHashSuffix.MatchString(base) {
+			// Routers: the rest of the name is exactly namespace-name
+			base = crdRouterHashSuffix.ReplaceAllString(base, "")
+			info.Namespace, info.Resource = p.splitKubernetesName(base, kubernetesNameExact)
+		} else {
+			// Services and middlewares: namespace-name, optionally followed by a port
+			info.Namespace, info.Resource = p.splitKubernetesName(base, kubernetesNamePort)
+		}
+	case providerKubernetesIngress:
+		// Routers are namespace-name-host-path
+		info.Namespace, info.Resource = p.splitKubernetesName(base, kubernetesNamePrefix)
+	default:
+		info.EntryPoint, info.Resource = p.splitEntryPoint(base)
+	}
+
+	return info
+}
+
+// splitKubernetesName splits a normalized namespace-name string. Known services
+// are tried longest first so app-admin wins over app in the same namespace.
+func (p *routerNameParser) splitKubernetesName(base string, mode int) (string, string) {
+	for _, s := range p.known {
+		key := BuildServiceName(s.Namespace, s.Name, "-")
+		if base == key {
+			return s.Namespace, s.Name
+		}
+		if !strings.HasPrefix(base, key+"-") {
+			continue
+		}
+		rest := base[len(key):]
+		if mode == kubernetesNamePrefix || (mode == kubernetesNamePort && crdServicePortSuffix.MatchString(rest)) {
+			return s.Namespace, s.Name
+		}
+	}
+
+	namespace, rest := "", base
+	for _, ns := range p.namespaces {
+		if strings.HasPrefix(base, ns+"-") {
+			namespace, rest = ns, base[len(ns)+1:]
+			break
+		}
+	}
+	if namespace == "" {
+		if mode == kubernetesNamePrefix {
+			// Host and path follow the name, so there is no telling where it ends
+			return "", base
+		}
+		// Nothing known, assume the namespace has no dashes
+		parts := strings.SplitN(base, "-", 2)
+		if len(parts) < 2 {
+			return "", base
+		}
+		namespace, rest = parts[0], parts[1]
+	}
+
+	switch mode {
+	case kubernetesNamePort:
+		if trimmed := crdServicePortSuffix.ReplaceAllString(rest, ""); trimmed != "" {
+			rest = trimmed
+		}
+	}
+	return namespace, rest
+}
+
+func (p *routerNameParser) splitEntryPoint(base string) (string, string) {
+	for _, ep := range p.entryPoints {
+		if strings.HasPrefix(base, ep+"-") && len(base) > len(ep)+1 {
+			return ep, base[len(ep)+1:]
+		}
+	}
+	return "", base
+}
+
+// normalizeTraefikName mirrors Traefik's provider.Normalize, which joins
+// runs of letters and digits with dashes when building Kubernetes names
+func normalizeTraefikName(name string) string {
+	fields := strings.FieldsFunc(strings.TrimSpace(name), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsNumber(c)
+	})
+	return strings.Join(fields, "-")
+}
+
+// isServiceAllowed reports whether the router belongs to one of the allowed services
+func isServiceAllowed(allowed []TraefikService, info RouterInfo) bool {
+	for _, s := range allowed {
+		if info.Matches(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRouterNameParserParse(t *testing.T) {
+	p := newRouterNameParser()
+	p.SetKnownServices("test", []TraefikService{
+		{Namespace: "shop", Name: "my-app"},
+		{Namespace: "monitoring"},
+	})
+
+	tests := []struct {
+		name      string
+		router    string
+		namespace string
+		resource  string
+	}{
+		{name: "crd router", router: "shop-my-app-6f9c2c1bd0e3a0f1b2c4@kubernetescrd", namespace: "shop", resource: "my-app"},
+		{name: "crd service with port", router: "shop-my-app-8080@kubernetescrd", namespace: "shop", resource: "my-app"},
+		{name: "known ingress", router: "shop-my-app-shop-example-com-api@kubernetes", namespace: "shop", resource: "my-app"},
+		{name: "ingress in known namespace", router: "monitoring-grafana-example-com@kubernetes", namespace: "monitoring", resource: "grafana-example-com"},
+		{name: "unknown ingress keeps raw name", router: "default-my-app-example-com@kubernetes", namespace: "", resource: "default-my-app-example-com"},
+		{name: "unknown crd service", router: "default-other-80@kubernetescrd", namespace: "default", resource: "other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := p.Parse(tt.router)
+			if info.Namespace != tt.namespace || info.Resource != tt.resource {
+				t.Errorf("Parse(%q) = %q/%q, want %q/%q", tt.router, info.Namespace, info.Resource, tt.namespace, tt.resource)
+			}
+		})
+	}
+}
+
+func TestRouterNameParserCacheIsBounded(t *testing.T) {
+	p := newRouterNameParser()
+	for i := 0; i < maxRouterNameCacheSize+10; i++ {
+		p.Parse(fmt.Sprintf("default-app-%d@kubernetes", i))
+	}
+	if size := len(p.cache); size > maxRouterNameCacheSize {
+		t.Errorf("cache holds %d names, want at most %d", size, maxRouterNameCacheSize)
+	}
+}
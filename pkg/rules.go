@@ -0,0 +1,447 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	ruleMatcherPath       = "Path"
+	ruleMatcherPathPrefix = "PathPrefix"
+	ruleMatcherPathRegexp = "PathRegexp"
+
+	traefikAPIPageSize = 100
+	traefikAPITimeout  = 10 * time.Second
+
+	// routerRuleParam names capture groups of PathRegexp rules that have no name
+	routerRuleParam = "{param}"
+)
+
+var routerRules = &routerRuleStore{rules: make(map[string][]*routerRuleTemplate)}
+
+// RouterRulesConfig configures where Traefik router rules are read from
+type RouterRulesConfig struct {
+	APIURL        string
+	DynamicConfig string
+	Refresh       time.Duration
+}
+
+// Enabled reports whether a source of router rules is configured
+func (c *RouterRulesConfig) Enabled() bool {
+	return c.APIURL != "" || c.DynamicConfig != ""
+}
+
+func AddRouterRulesFlags(flags *flag.FlagSet) *RouterRulesConfig {
+	config := &RouterRulesConfig{}
+
+	flags.StringVar(&config.APIURL, "traefik-api-url", "",
+		"Traefik API base URL (e.g. http://traefik:8080) to read router rules from for endpoint templates")
+	flags.StringVar(&config.DynamicConfig, "traefik-dynamic-config", "",
+		"Traefik dynamic configuration file (YAML or JSON) to read router rules from for endpoint templates")
+	flags.DurationVar(&config.Refresh, "traefik-rules-refresh", time.Minute,
+		"How often router rules are re-read")
+	return config
+}
+
+// routerRuleTemplate is a Path, PathPrefix or PathRegexp matcher of a router rule
+type routerRuleTemplate struct {
+	matcher  string
+	regex    *regexp.Regexp
+	template string   // Path and PathPrefix: the argument with {name:regexp} reduced to {name}
+	names    []string // PathRegexp: the template of each capture group
+}
+
+// apply returns the templated path when the request matches. complete is
+// false when part of the path is left to the fallbacks, such as the remainder
+// of a PathPrefix.
+func (t *routerRuleTemplate) apply(path string) (normalized string, complete bool, ok bool) {
+	switch t.matcher {
+	case ruleMatcherPath:
+		if t.regex.MatchString(path) {
+			return t.template, true, true
+		}
+	case ruleMatcherPathPrefix:
+		if loc := t.regex.FindStringIndex(path); loc != nil {
+			return t.template + path[loc[1]:], false, true
+		}
+	case ruleMatcherPathRegexp:
+		loc := t.regex.FindStringSubmatchIndex(path)
+		if loc == nil {
+			return "", false, false
+		}
+		var b strings.Builder
+		last := 0
+		for group := 1; group < len(loc)/2; group++ {
+			start, end := loc[2*group], loc[2*group+1]
+			// Nested groups are covered by their enclosing group
+			if start < last || start == -1 {
+				continue
+			}
+			b.WriteString(path[last:start])
+			b.WriteString(t.names[group])
+			last = end
+		}
+		b.WriteString(path[last:])
+		// The fallbacks still template the path when there are no capture groups
+		// or the regexp leaves a remainder, as in ^/(api|admin)/
+		return b.String(), len(loc) > 2 && loc[1] == len(path), true
+	}
+	return "", false, false
+}
+
+// specificity orders templates: exact paths, then regexps, then the longest prefix
+func (t *routerRuleTemplate) specificity() (int, int) {
+	switch t.matcher {
+	case ruleMatcherPath:
+		return 2, len(t.template)
+	case ruleMatcherPathRegexp:
+		return 1, len(t.regex.String())
+	}
+	return 0, len(t.template)
+}
+
+// routerRuleStore holds the compiled rule templates by router name
+type routerRuleStore struct {
+	mu    sync.RWMutex
+	rules map[string][]*routerRuleTemplate
+}
+
+// Set replaces the rules with the ones parsed from the given router rules
+func (s *routerRuleStore) Set(routerRules map[string]string) {
+	rules := make(map[string][]*routerRuleTemplate, len(routerRules))
+	for router, rule := range routerRules {
+		templates, err := parseRouterRule(rule)
+		if err != nil {
+			logger.Warnf("Ignoring rule of router %s: %v", router, err)
+			continue
+		}
+		if len(templates) == 0 {
+			continue
+		}
+		sort.SliceStable(templates, func(i, j int) bool {
+			ki, li := templates[i].specificity()
+			kj, lj := templates[j].specificity()
+			if ki != kj {
+				return ki > kj
+			}
+			return li > lj
+		})
+		rules[router] = templates
+	}
+
+	s.mu.Lock()
+	s.rules = rules
+	s.mu.Unlock()
+}
+
+// Apply templates the path with the first matching matcher of the router's rule
+func (s *routerRuleStore) Apply(router, path string) (normalized string, complete bool, ok bool) {
+	s.mu.RLock()
+	templates := s.rules[router]
+	s.mu.RUnlock()
+
+	for _, t := range templates {
+		if normalized, complete, ok := t.apply(path); ok {
+			return normalized, complete, true
+		}
+	}
+	return "", false, false
+}
+
+// parseRouterRule extracts the path matchers of a rule such as
+// Host(`example.com`) && (Path(`/users/{id}`) || PathPrefix(`/api`))
+func parseRouterRule(rule string) ([]*routerRuleTemplate, error) {
+	var templates []*routerRuleTemplate
+	for i := 0; i < len(rule); {
+		if !isRuleIdentChar(rule[i]) || (i > 0 && isRuleIdentChar(rule[i-1])) {
+			i++
+			continue
+		}
+		end := i
+		for end < len(rule) && isRuleIdentChar(rule[end]) {
+			end++
+		}
+		name := rule[i:end]
+		if end >= len(rule) || rule[end] != '(' {
+			i = end
+			continue
+		}
+
+		args, next, err := parseRuleArguments(rule, end+1)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		i = next
+		if strings.HasSuffix(strings.TrimRight(rule[:end-len(name)], " "), "!") {
+			// Negated matchers describe paths the router does not serve
+			continue
+		}
+
+		for _, arg := range args {
+			var t *routerRuleTemplate
+			switch name {
+			case ruleMatcherPath, ruleMatcherPathPrefix:
+				t, err = compilePathTemplate(name, arg)
+			case ruleMatcherPathRegexp:
+				t, err = compilePathRegexp(arg)
+			default:
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s(%q): %w", name, arg, err)
+			}
+			templates = append(templates, t)
+		}
+	}
+	return templates, nil
+}
+
+func isRuleIdentChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// parseRuleArguments reads the quoted, comma separated arguments starting at pos
+// up to the closing parenthesis and returns them with the position after it
+func parseRuleArguments(rule string, pos int) ([]string, int, error) {
+	var args []string
+	for pos < len(rule) {
+		switch c := rule[pos]; c {
+		case ')':
+			return args, pos + 1, nil
+		case ' ', ',', '\t', '\n':
+			pos++
+		case '`':
+			end := strings.IndexByte(rule[pos+1:], '`')
+			if end == -1 {
+				return nil, 0, fmt.Errorf("unterminated argument")
+			}
+			args = append(args, rule[pos+1:pos+1+end])
+			pos += end + 2
+		case '"':
+			end := pos + 1
+			for end < len(rule) && rule[end] != '"' {
+				if rule[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(rule) {
+				return nil, 0, fmt.Errorf("unterminated argument")
+			}
+			arg, err := strconv.Unquote(rule[pos : end+1])
+			if err != nil {
+				return nil, 0, err
+			}
+			args = append(args, arg)
+			pos = end + 1
+		default:
+			return nil, 0, fmt.Errorf("unexpected %q", c)
+		}
+	}
+	return nil, 0, fmt.Errorf("missing closing parenthesis")
+}
+
+// compilePathTemplate compiles Path and PathPrefix arguments, which may hold
+// Traefik v2 variables such as {id} or {id:[0-9]+}
+func compilePathTemplate(matcher, arg string) (*routerRuleTemplate, error) {
+	var expr, template strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(arg); {
+		if arg[i] != '{' {
+			next := strings.IndexByte(arg[i:], '{')
+			if next == -1 {
+				next = len(arg) - i
+			}
+			expr.WriteString(regexp.QuoteMeta(arg[i : i+next]))
+			template.WriteString(arg[i : i+next])
+			i += next
+			continue
+		}
+
+		// Find the matching brace, variable regexps may contain {n} quantifiers
+		depth, end := 0, i
+		for ; end < len(arg); end++ {
+			if arg[end] == '{' {
+				depth++
+			} else if arg[end] == '}' {
+				depth--
+				if depth == 0 {
+					break
+				}
+			}
+		}
+		if end >= len(arg) {
+			return nil, fmt.Errorf("unbalanced braces")
+		}
+		name, pattern, hasPattern := strings.Cut(arg[i+1:end], ":")
+		if !hasPattern {
+			pattern = `[^/]+`
+		}
+		expr.WriteString("(?:" + pattern + ")")
+		template.WriteString("{" + name + "}")
+		i = end + 1
+	}
+	if matcher == ruleMatcherPath {
+		expr.WriteString("$")
+	}
+
+	regex, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, err
+	}
+	return &routerRuleTemplate{matcher: matcher, regex: regex, template: template.String()}, nil
+}
+
+// compilePathRegexp compiles a PathRegexp argument. Capture groups become
+// {name} for named groups and {param} otherwise.
+func compilePathRegexp(arg string) (*routerRuleTemplate, error) {
+	regex, err := regexp.Compile(arg)
+	if err != nil {
+		return nil, err
+	}
+	names := regex.SubexpNames()
+	for i := range names {
+		if names[i] == "" {
+			names[i] = routerRuleParam
+		} else {
+			names[i] = "{" + names[i] + "}"
+		}
+	}
+	return &routerRuleTemplate{matcher: ruleMatcherPathRegexp, regex: regex, names: names}, nil
+}
+
+// traefikRouter is a router as returned by the Traefik API
+type traefikRouter struct {
+	Name string `json:"name"`
+	Rule string `json:"rule"`
+}
+
+// fetchTraefikRouterRules reads all HTTP routers from the Traefik API
+func fetchTraefikRouterRules(apiURL string) (map[string]string, error) {
+	client := &http.Client{Timeout: traefikAPITimeout}
+	rules := make(map[string]string)
+	for page := 1; ; {
+		url := fmt.Sprintf("%s/api/http/routers?per_page=%d&page=%d", strings.TrimRight(apiURL, "/"), traefikAPIPageSize, page)
+		resp, err := client.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			logger.Warnf("Error closing response body: %v", closeErr)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %s from %s", resp.Status, url)
+		}
+
+		var routers []traefikRouter
+		if err := json.Unmarshal(body, &routers); err != nil {
+			return nil, fmt.Errorf("failed to parse routers: %w", err)
+		}
+		for _, router := range routers {
+			rules[router.Name] = router.Rule
+		}
+
+		// Traefik points X-Next-Page back at page 1 after the last page
+		next, err := strconv.Atoi(resp.Header.Get("X-Next-Page"))
+		if err != nil || next <= page {
+			return rules, nil
+		}
+		page = next
+	}
+}
+
+// readDynamicConfigRouterRules reads the HTTP routers of a Traefik dynamic
+// configuration file. Its routers are named <name>@file in access logs.
+func readDynamicConfigRouterRules(location string) (map[string]string, error) {
+	data, err := os.ReadFile(location)
+	if err != nil {
+		return nil, err
+	}
+	var dynamicConfig struct {
+		HTTP struct {
+			Routers map[string]struct {
+				Rule string `json:"rule"`
+			} `json:"routers"`
+		} `json:"http"`
+	}
+	if err := yaml.Unmarshal(data, &dynamicConfig); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", location, err)
+	}
+
+	rules := make(map[string]string, len(dynamicConfig.HTTP.Routers))
+	for name, router := range dynamicConfig.HTTP.Routers {
+		if !strings.Contains(name, "@") {
+			name += "@file"
+		}
+		rules[name] = router.Rule
+	}
+	return rules, nil
+}
+
+// refreshRouterRules reads the rules from all configured sources
+func refreshRouterRules(config *RouterRulesConfig) error {
+	rules := make(map[string]string)
+	if config.DynamicConfig != "" {
+		fileRules, err := readDynamicConfigRouterRules(config.DynamicConfig)
+		if err != nil {
+			return err
+		}
+		for name, rule := range fileRules {
+			rules[name] = rule
+		}
+	}
+	if config.APIURL != "" {
+		apiRules, err := fetchTraefikRouterRules(config.APIURL)
+		if err != nil {
+			return err
+		}
+		for name, rule := range apiRules {
+			rules[name] = rule
+		}
+	}
+
+	routerRules.Set(rules)
+	logger.Debugf("Loaded rules of %d routers", len(rules))
+	return nil
+}
+
+// startRouterRulesRefresher loads the router rules and keeps them up to date
+func startRouterRulesRefresher(config *RouterRulesConfig) {
+	refresh := func() {
+		if err := refreshRouterRules(config); err != nil {
+			UpdateHealthStatus("router_rules", "error", err)
+			logger.Errorf("Failed to read Traefik router rules: %v", err)
+			return
+		}
+		UpdateHealthStatus("router_rules", "running", nil)
+	}
+	refresh()
+
+	if config.Refresh <= 0 {
+		return
+	}
+	ticker := time.NewTicker(config.Refresh)
+	go func() {
+		defer ticker.Stop()
+		for range ticker.C {
+			refresh()
+		}
+	}()
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestRouterRuleTemplateApply(t *testing.T) {
+	tests := []struct {
+		name         string
+		matcher      string
+		arg          string
+		path         string
+		want         string
+		wantComplete bool
+		wantOK       bool
+	}{
+		{name: "path variable", matcher: ruleMatcherPath, arg: "/users/{id}", path: "/users/42", want: "/users/{id}", wantComplete: true, wantOK: true},
+		{name: "path variable with regexp", matcher: ruleMatcherPath, arg: "/users/{id:[0-9]{1,5}}", path: "/users/42", want: "/users/{id}", wantComplete: true, wantOK: true},
+		{name: "path variable regexp mismatch", matcher: ruleMatcherPath, arg: "/users/{id:[0-9]+}", path: "/users/me"},
+		{name: "path is exact", matcher: ruleMatcherPath, arg: "/users", path: "/users/42"},
+		{name: "prefix keeps remainder", matcher: ruleMatcherPathPrefix, arg: "/shops/{shop}", path: "/shops/acme/orders/7", want: "/shops/{shop}/orders/7", wantOK: true},
+		{name: "regexp named group", matcher: ruleMatcherPathRegexp, arg: `^/orders/(?P<order>[0-9]+)$`, path: "/orders/12", want: "/orders/{order}", wantComplete: true, wantOK: true},
+		{name: "regexp unnamed group", matcher: ruleMatcherPathRegexp, arg: `^/files/([a-f0-9]+)/raw$`, path: "/files/beef/raw", want: "/files/{param}/raw", wantComplete: true, wantOK: true},
+		{name: "regexp nested groups", matcher: ruleMatcherPathRegexp, arg: `^/v(1|2)/((a|b)+)$`, path: "/v2/abab", want: "/v{param}/{param}", wantComplete: true, wantOK: true},
+		{name: "regexp leaves remainder", matcher: ruleMatcherPathRegexp, arg: `^/(api|admin)/`, path: "/api/users/42", want: "/{param}/users/42", wantOK: true},
+		{name: "regexp without groups", matcher: ruleMatcherPathRegexp, arg: `^/static/.*`, path: "/static/app.js", want: "/static/app.js", wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var template *routerRuleTemplate
+			var err error
+			if tt.matcher == ruleMatcherPathRegexp {
+				template, err = compilePathRegexp(tt.arg)
+			} else {
+				template, err = compilePathTemplate(tt.matcher, tt.arg)
+			}
+			if err != nil {
+				t.Fatalf("compiling %s(%q): %v", tt.matcher, tt.arg, err)
+			}
+			got, complete, ok := template.apply(tt.path)
+			if got != tt.want || complete != tt.wantComplete || ok != tt.wantOK {
+				t.Errorf("apply(%q) = %q, %t, %t, want %q, %t, %t", tt.path, got, complete, ok, tt.want, tt.wantComplete, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestParseRouterRule(t *testing.T) {
+	templates, err := parseRouterRule("Host(`example.com`) && (Path(`/a`, `/b`) || PathPrefix(\"/c\")) && !PathPrefix(`/c/internal`)")
+	if err != nil {
+		t.Fatalf("parsing rule: %v", err)
+	}
+	var got []string
+	for _, template := range templates {
+		got = append(got, template.matcher+" "+template.template)
+	}
+	want := []string{"Path /a", "Path /b", "PathPrefix /c"}
+	if len(got) != len(want) {
+		t.Fatalf("templates = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("templates = %v, want %v", got, want)
+			break
+		}
+	}
+
+	if _, err := parseRouterRule("Path(`/unterminated)"); err == nil {
+		t.Error("unterminated argument was accepted")
+	}
+}
+
+// TestRouterRulesFromTraefikAPI serves /api/http/routers over two pages and
+// checks the templates end to end through normalizeURL
+func TestRouterRulesFromTraefikAPI(t *testing.T) {
+	pages := [][]traefikRouter{
+		{
+			{Name: "users@file", Rule: "Host(`example.com`) && Path(`/users/{id:[0-9]+}`)"},
+			{Name: "shops@file", Rule: "PathPrefix(`/shops/{shop}`)"},
+		},
+		{
+			{Name: "orders@file", Rule: "PathRegexp(`^/orders/(?P<order>[0-9]+)/items/([0-9]+)$`)"},
+			{Name: "areas@file", Rule: "PathRegexp(`^/(api|admin)/`)"},
+		},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/http/routers" {
+			http.NotFound(w, r)
+			return
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page < 1 || page > len(pages) {
+			page = 1
+		}
+		// Traefik points X-Next-Page back at page 1 after the last page
+		next := page + 1
+		if next > len(pages) {
+			next = 1
+		}
+		w.Header().Set("X-Next-Page", strconv.Itoa(next))
+		_ = json.NewEncoder(w).Encode(pages[page-1])
+	}))
+	defer server.Close()
+
+	if err := refreshRouterRules(&RouterRulesConfig{APIURL: server.URL}); err != nil {
+		t.Fatalf("reading router rules: %v", err)
+	}
+	defer routerRules.Set(nil)
+
+	config := &TraefikOfficerConfig{}
+	config.compile()
+
+	tests := []struct {
+		router string
+		path   string
+		want   string
+	}{
+		{router: "users@file", path: "/users/42", want: "/users/{id}"},
+		{router: "users@file", path: "/users/42?expand=true", want: "/users/{id}?{query_params}"},
+		{router: "shops@file", path: "/shops/acme/orders/7", want: "/shops/{shop}/orders/{id}"},
+		{router: "orders@file", path: "/orders/12/items/3", want: "/orders/{order}/items/{param}"},
+		{router: "areas@file", path: "/api/users/42", want: "/{param}/users/{id}"},
+		{router: "unknown@file", path: "/users/42", want: "/users/{id}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.router+tt.path, func(t *testing.T) {
+			if got := normalizeURL(RouterInfo{Name: tt.router}, "GET", tt.path, config); got != tt.want {
+				t.Errorf("normalizeURL(%s, %q) = %q, want %q", tt.router, tt.path, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	// sequenceReorderWindow is how far behind the highest RequestCount seen a line may
+	// arrive and still be treated as out of order rather than a Traefik restart
+	sequenceReorderWindow = 1000
+	// sequenceLossWindow is the period over which the loss ratio used for health is computed
+	sequenceLossWindow = 5 * time.Minute
+)
+
+var (
+	logMissedRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "traefik_officer_log_missed_requests_total",
+			Help: "Estimated number of access log lines missed, based on gaps in Traefik's RequestCount",
+		},
+		[]string{"source"},
+	)
+
+	logOutOfOrderLines = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "traefik_officer_log_out_of_order_lines_total",
+			Help: "Number of access log lines received with a RequestCount lower than one already seen",
+		},
+		[]string{"source"},
+	)
+
+	logSequenceResets = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "traefik_officer_log_sequence_resets_total",
+			Help: "Number of times a source's RequestCount went backwards, usually a Traefik restart",
+		},
+		[]string{"source"},
+	)
+
+	// logLossThreshold is the ratio of missed lines above which health is degraded
+	logLossThreshold = 0.05
+
+	sequences = &sequenceTracker{sources: make(map[string]*sourceSequence)}
+)
+
+// sourceSequence tracks the RequestCount sequence of a single Traefik instance
+type sourceSequence struct {
+	highest int
+
+	// Counters for the current and previous loss windows
+	windowStart time.Time
+	seen        int64
+	missed      int64
+	prevSeen    int64
+	prevMissed  int64
+}
+
+// sequenceTracker detects gaps in the RequestCount sequence per log source
+type sequenceTracker struct {
+	mu      sync.Mutex
+	sources map[string]*sourceSequence
+}
+
+// Observe records a RequestCount seen from the given source and updates the loss counters
+func (st *sequenceTracker) Observe(source string, count int, now time.Time) {
+	if count <= 0 {
+		return
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	seq, exists := st.sources[source]
+	if !exists {
+		st.sources[source] = &sourceSequence{highest: count, windowStart: now, seen: 1}
+		return
+	}
+
+	if now.Sub(seq.windowStart) >= sequenceLossWindow {
+		seq.prevSeen, seq.prevMissed = seq.seen, seq.missed
+		seq.seen, seq.missed = 0, 0
+		seq.windowStart = now
+	}
+	seq.seen++
+
+	switch {
+	case count == seq.highest+1:
+		seq.highest = count
+	case count > seq.highest:
+		gap := int64(count - seq.highest - 1)
+		seq.missed += gap
+		seq.highest = count
+		logMissedRequests.WithLabelValues(source).Add(float64(gap))
+		series.Touch("log_missed_requests_total", logMissedRequests, source)
+		logger.Debugf("Gap of %d requests in sequence from %s", gap, source)
+	case !isSequenceReset(seq.highest, count):
+		// A late line fills a gap that was already counted as missed
+		logOutOfOrderLines.WithLabelValues(source).Inc()
+		series.Touch("log_out_of_order_lines_total", logOutOfOrderLines, source)
+		if seq.missed > 0 {
+			seq.missed--
+		}
+	default:
+		logger.Infof("RequestCount for %s went from %d to %d, assuming Traefik restarted", source, seq.highest, count)
+		logSequenceResets.WithLabelValues(source).Inc()
+		series.Touch("log_sequence_resets_total", logSequenceResets, source)
+		seq.highest = count
+	}
+}
+
+// isSequenceReset reports whether a RequestCount below the highest one seen
+// means Traefik restarted rather than a line arriving late. A restarted Traefik
+// counts from 1 again, so a drop to less than half the highest count is a reset
+// even within the reorder window.
+func isSequenceReset(highest, count int) bool {
+	return highest-count >= sequenceReorderWindow || highest-count > count
+}
+
+// LossRatio returns the highest estimated ratio of missed lines across all sources
+// over the last one to two loss windows, and the source it belongs to
+func (st *sequenceTracker) LossRatio() (float64, string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	worst, worstSource := 0.0, ""
+	for source, seq := range st.sources {
+		missed := seq.missed + seq.prevMissed
+		total := seq.seen + seq.prevSeen + missed
+		if total == 0 {
+			continue
+		}
+		ratio := float64(missed) / float64(total)
+		if ratio > worst {
+			worst, worstSource = ratio, source
+		}
+	}
+	return worst, worstSource
+}
+
+// Forget drops tracking state and series for a source that no longer exists
+func (st *sequenceTracker) Forget(source string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	delete(st.sources, source)
+	logMissedRequests.DeleteLabelValues(source)
+	logOutOfOrderLines.DeleteLabelValues(source)
+	logSequenceResets.DeleteLabelValues(source)
+}
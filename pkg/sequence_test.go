@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSequenceTrackerObserve(t *testing.T) {
+	tests := []struct {
+		name       string
+		counts     []int
+		wantMissed int64
+		wantResets float64
+	}{
+		{name: "contiguous", counts: []int{1, 2, 3, 4}, wantMissed: 0},
+		{name: "gap", counts: []int{1, 2, 6, 7}, wantMissed: 3},
+		{name: "late line fills gap", counts: []int{1, 2, 6, 4}, wantMissed: 2},
+		{name: "restart beyond reorder window", counts: []int{5000, 5001, 1, 2}, wantMissed: 0, wantResets: 1},
+		{name: "restart within reorder window", counts: []int{400, 401, 1, 2, 3}, wantMissed: 0, wantResets: 1},
+		{name: "restart after gap keeps loss", counts: []int{400, 410, 1, 2, 3}, wantMissed: 9, wantResets: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := "test-" + tt.name
+			tracker := &sequenceTracker{sources: make(map[string]*sourceSequence)}
+			defer tracker.Forget(source)
+
+			now := time.Now()
+			for _, count := range tt.counts {
+				tracker.Observe(source, count, now)
+			}
+			if missed := tracker.sources[source].missed; missed != tt.wantMissed {
+				t.Errorf("missed = %d, want %d", missed, tt.wantMissed)
+			}
+			if resets := testutil.ToFloat64(logSequenceResets.WithLabelValues(source)); resets != tt.wantResets {
+				t.Errorf("resets = %v, want %v", resets, tt.wantResets)
+			}
+		})
+	}
+}
+
+func TestSequenceTrackerForgetDeletesSeries(t *testing.T) {
+	tracker := &sequenceTracker{sources: make(map[string]*sourceSequence)}
+	now := time.Now()
+	tracker.Observe("gone", 1, now)
+	tracker.Observe("gone", 5, now)
+	tracker.Observe("gone", 3, now)
+
+	tracker.Forget("gone")
+
+	for name, vec := range map[string]interface{ DeleteLabelValues(...string) bool }{
+		"missed":       logMissedRequests,
+		"out of order": logOutOfOrderLines,
+		"resets":       logSequenceResets,
+	} {
+		if vec.DeleteLabelValues("gone") {
+			t.Errorf("%s series of a forgotten source still exists", name)
+		}
+	}
+}
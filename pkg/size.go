@@ -0,0 +1,74 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// sizeBuckets span 64B to 64MB in powers of four
+var sizeBuckets = prometheus.ExponentialBuckets(64, 4, 11)
+
+var (
+	responseSize = registerHistogramSet(
+		prometheus.HistogramOpts{
+			Name: "traefik_officer_response_size_bytes",
+			Help: "Size of HTTP response bodies in bytes",
+		},
+		[]string{"app"},
+	)
+
+	endpointResponseSize = registerHistogramSet(
+		prometheus.HistogramOpts{
+			Name: "traefik_officer_endpoint_response_size_bytes",
+			Help: "Size of HTTP response bodies per endpoint in bytes",
+		},
+		[]string{"app", "request_path"},
+	)
+
+	requestSize = registerHistogramSet(
+		prometheus.HistogramOpts{
+			Name: "traefik_officer_request_size_bytes",
+			Help: "Size of HTTP request bodies in bytes, JSON logs only",
+		},
+		[]string{"app"},
+	)
+
+	endpointRequestSize = registerHistogramSet(
+		prometheus.HistogramOpts{
+			Name: "traefik_officer_endpoint_request_size_bytes",
+			Help: "Size of HTTP request bodies per endpoint in bytes, JSON logs only",
+		},
+		[]string{"app", "request_path"},
+	)
+
+	namespaceResponseBytes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "traefik_officer_namespace_response_bytes_total",
+			Help: "Total bytes of HTTP response bodies served per namespace",
+		},
+		[]string{"namespace"},
+	)
+)
+
+// updateSizeMetrics records the body sizes of a request. pathLabel is the
+// request_path label the request is counted under.
+func updateSizeMetrics(entry *traefikLogConfig, config *TraefikOfficerConfig, service, pathLabel string) {
+	layout := histogramLayout{buckets: sizeBuckets, native: config.NativeHistograms}
+
+	responseBytes := float64(entry.OriginContentSize)
+	responseSize.WithLabelValues(layout, service).Observe(responseBytes)
+	endpointResponseSize.WithLabelValues(layout, service, pathLabel).Observe(responseBytes)
+	namespaceResponseBytes.WithLabelValues(entry.Router.Namespace).Add(responseBytes)
+	series.Touch("response_size_bytes", responseSize, service)
+	series.Touch("endpoint_response_size_bytes", endpointResponseSize, service, pathLabel)
+	series.Touch("namespace_response_bytes_total", namespaceResponseBytes, entry.Router.Namespace)
+
+	// Only JSON logs carry the request size
+	if entry.RequestContentSize != nil {
+		requestBytes := float64(*entry.RequestContentSize)
+		requestSize.WithLabelValues(layout, service).Observe(requestBytes)
+		endpointRequestSize.WithLabelValues(layout, service, pathLabel).Observe(requestBytes)
+		series.Touch("request_size_bytes", requestSize, service)
+		series.Touch("endpoint_request_size_bytes", endpointRequestSize, service, pathLabel)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// histogramSample returns the sample count and sum of one series of a histogram collector
+func histogramSample(t *testing.T, c prometheus.Collector, lvs ...string) (uint64, float64) {
+	t.Helper()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gathering: %v", err)
+	}
+	for _, family := range families {
+	metrics:
+		for _, metric := range family.GetMetric() {
+			labels := metric.GetLabel()
+			if len(labels) != len(lvs) {
+				continue
+			}
+			// Gathered labels are sorted by name, the label values here are too
+			for i, label := range labels {
+				if label.GetValue() != lvs[i] {
+					continue metrics
+				}
+			}
+			return metric.GetHistogram().GetSampleCount(), metric.GetHistogram().GetSampleSum()
+		}
+	}
+	return 0, 0
+}
+
+func TestUpdateSizeMetrics(t *testing.T) {
+	config := &TraefikOfficerConfig{}
+	config.compile()
+	requestBytes := 2048
+
+	tests := []struct {
+		name         string
+		service      string
+		entry        traefikLogConfig
+		wantRequests uint64
+		wantSum      float64
+	}{
+		{
+			name:    "common log format",
+			service: "size-test-clf",
+			entry:   traefikLogConfig{OriginContentSize: 512, Router: RouterInfo{Namespace: "size-test-clf"}},
+		},
+		{
+			name:         "JSON log with the request size",
+			service:      "size-test-json",
+			entry:        traefikLogConfig{OriginContentSize: 512, RequestContentSize: &requestBytes, Router: RouterInfo{Namespace: "size-test-json"}, fromJSON: true},
+			wantRequests: 1,
+			wantSum:      2048,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(func() {
+				responseSize.DeleteLabelValues(tt.service)
+				endpointResponseSize.DeleteLabelValues(tt.service, "/upload")
+				requestSize.DeleteLabelValues(tt.service)
+				endpointRequestSize.DeleteLabelValues(tt.service, "/upload")
+				namespaceResponseBytes.DeleteLabelValues(tt.service)
+			})
+			updateSizeMetrics(&tt.entry, config, tt.service, "/upload")
+			updateSizeMetrics(&tt.entry, config, tt.service, "/upload")
+
+			if count, sum := histogramSample(t, responseSize, tt.service); count != 2 || sum != 1024 {
+				t.Errorf("response sizes = %d summing to %v, want 2 summing to 1024", count, sum)
+			}
+			if count, _ := histogramSample(t, endpointResponseSize, tt.service, "/upload"); count != 2 {
+				t.Errorf("endpoint response sizes = %d, want 2", count)
+			}
+			if got := testutil.ToFloat64(namespaceResponseBytes.WithLabelValues(tt.service)); got != 1024 {
+				t.Errorf("namespace response bytes = %v, want 1024", got)
+			}
+			if count, sum := histogramSample(t, requestSize, tt.service); count != 2*tt.wantRequests || sum != 2*tt.wantSum {
+				t.Errorf("request sizes = %d summing to %v, want %d summing to %v", count, sum, 2*tt.wantRequests, 2*tt.wantSum)
+			}
+			if count, _ := histogramSample(t, endpointRequestSize, tt.service, "/upload"); count != 2*tt.wantRequests {
+				t.Errorf("endpoint request sizes = %d, want %d", count, 2*tt.wantRequests)
+			}
+		})
+	}
+}
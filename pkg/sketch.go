@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// sketchRelativeAccuracy bounds the relative error of every quantile estimate
+	sketchRelativeAccuracy = 0.01
+	// sketchMinValue is the smallest latency given its own bin, smaller ones count as zero
+	sketchMinValue = 1e-6
+	// sketchMaxBins bounds the memory of a sketch by merging its lowest bins
+	sketchMaxBins = 2048
+)
+
+var (
+	defaultQuantiles = []float64{0.5, 0.9, 0.99}
+
+	sketchGamma    = (1 + sketchRelativeAccuracy) / (1 - sketchRelativeAccuracy)
+	sketchLogGamma = math.Log(sketchGamma)
+)
+
+// ddSketch is a DDSketch: latencies are counted in logarithmic bins whose
+// boundaries are powers of sketchGamma, so sketches built anywhere with the same
+// accuracy merge exactly by adding bin counts
+type ddSketch struct {
+	Bins      map[int]int64 `json:"bins"`
+	ZeroCount int64         `json:"zero_count"`
+	Count     int64         `json:"count"`
+	Sum       float64       `json:"sum"`
+	Min       float64       `json:"min"`
+	Max       float64       `json:"max"`
+}
+
+func newDDSketch() *ddSketch {
+	return &ddSketch{Bins: make(map[int]int64)}
+}
+
+func sketchIndex(value float64) int {
+	return int(math.Ceil(math.Log(value) / sketchLogGamma))
+}
+
+// sketchValue is the estimate of bin index, within the relative accuracy of every value in it
+func sketchValue(index int) float64 {
+	return 2 * math.Pow(sketchGamma, float64(index)) / (sketchGamma + 1)
+}
+
+func (s *ddSketch) Add(value float64) {
+	if s.Count == 0 || value < s.Min {
+		s.Min = value
+	}
+	if s.Count == 0 || value > s.Max {
+		s.Max = value
+	}
+	s.Count++
+	s.Sum += value
+
+	if value < sketchMinValue {
+		s.ZeroCount++
+		return
+	}
+	s.Bins[sketchIndex(value)]++
+	if len(s.Bins) > sketchMaxBins {
+		s.collapseLowest()
+	}
+}
+
+// collapseLowest folds the lowest bin into the next one, trading accuracy of
+// the fastest requests for bounded memory
+func (s *ddSketch) collapseLowest() {
+	indexes := s.sortedIndexes()
+	lowest, next := indexes[0], indexes[1]
+	s.Bins[next] += s.Bins[lowest]
+	delete(s.Bins, lowest)
+}
+
+func (s *ddSketch) sortedIndexes() []int {
+	indexes := make([]int, 0, len(s.Bins))
+	for index := range s.Bins {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// Merge adds the values of other to the sketch
+func (s *ddSketch) Merge(other *ddSketch) {
+	if other == nil || other.Count == 0 {
+		return
+	}
+	if s.Count == 0 || other.Min < s.Min {
+		s.Min = other.Min
+	}
+	if s.Count == 0 || other.Max > s.Max {
+		s.Max = other.Max
+	}
+	s.Count += other.Count
+	s.Sum += other.Sum
+	s.ZeroCount += other.ZeroCount
+	for index, count := range other.Bins {
+		s.Bins[index] += count
+	}
+	for len(s.Bins) > sketchMaxBins {
+		s.collapseLowest()
+	}
+}
+
+// Quantile estimates the q-quantile, 0 for an empty sketch
+func (s *ddSketch) Quantile(q float64) float64 {
+	if s == nil || s.Count == 0 {
+		return 0
+	}
+	rank := int64(q * float64(s.Count-1))
+	if rank < s.ZeroCount {
+		return s.Min
+	}
+
+	seen := s.ZeroCount
+	for _, index := range s.sortedIndexes() {
+		seen += s.Bins[index]
+		if seen > rank {
+			return math.Max(s.Min, math.Min(sketchValue(index), s.Max))
+		}
+	}
+	return s.Max
+}
+
+// sketchResponse is the JSON served at /sketches
+type sketchResponse struct {
+	RelativeAccuracy float64          `json:"relative_accuracy"`
+	Gamma            float64          `json:"gamma"`
+	MinValue         float64          `json:"min_value"`
+	Sketches         []endpointSketch `json:"sketches"`
+}
+
+type endpointSketch struct {
+	App         string    `json:"app"`
+	RequestPath string    `json:"request_path"`
+	Window      string    `json:"window"`
+	Sketch      *ddSketch `json:"sketch"`
+}
+
+// SketchesHandler serves the latency sketch of every endpoint and window so
+// they can be merged across replicas. The app and window query parameters filter the result.
+func SketchesHandler(w http.ResponseWriter, r *http.Request) {
+	app, window := r.URL.Query().Get("app"), r.URL.Query().Get("window")
+	now := time.Now()
+	windows := CurrentConfig().Windows()
+
+	response := sketchResponse{
+		RelativeAccuracy: sketchRelativeAccuracy,
+		Gamma:            sketchGamma,
+		MinValue:         sketchMinValue,
+		Sketches:         make([]endpointSketch, 0),
+	}
+
+	endpointStatsMutex.RLock()
+	for key, stat := range endpointStats {
+		service, endpoint, ok := strings.Cut(key, ":")
+		if !ok || (app != "" && service != app) {
+			continue
+		}
+		for _, sw := range windows {
+			if window != "" && sw.label != window {
+				continue
+			}
+			if summary, exists := stat.Window(sw, now); exists && summary.Requests > 0 {
+				response.Sketches = append(response.Sketches, endpointSketch{
+					App: service, RequestPath: endpoint, Window: sw.label, Sketch: summary.sketch,
+				})
+			}
+		}
+	}
+	endpointStatsMutex.RUnlock()
+
+	sort.Slice(response.Sketches, func(i, j int) bool {
+		a, b := response.Sketches[i], response.Sketches[j]
+		if a.App != b.App {
+			return a.App < b.App
+		}
+		if a.RequestPath != b.RequestPath {
+			return a.RequestPath < b.RequestPath
+		}
+		return a.Window < b.Window
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
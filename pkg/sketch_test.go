@@ -0,0 +1,99 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestDDSketchQuantile(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name   string
+		values func(i int) float64
+	}{
+		{name: "uniform", values: func(int) float64 { return random.Float64() * 2 }},
+		{name: "exponential", values: func(int) float64 { return random.ExpFloat64() / 10 }},
+		{name: "lognormal", values: func(int) float64 { return math.Exp(random.NormFloat64()) / 100 }},
+		{name: "constant", values: func(int) float64 { return 0.25 }},
+		{name: "increasing", values: func(i int) float64 { return float64(i+1) / 1000 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sketch := newDDSketch()
+			values := make([]float64, 10000)
+			for i := range values {
+				values[i] = tt.values(i)
+				sketch.Add(values[i])
+			}
+			sort.Float64s(values)
+
+			for _, q := range []float64{0, 0.5, 0.9, 0.99, 0.999, 1} {
+				exact := values[int(q*float64(len(values)-1))]
+				got := sketch.Quantile(q)
+				if math.Abs(got-exact) > sketchRelativeAccuracy*exact+1e-12 {
+					t.Errorf("Quantile(%v) = %v, want %v within %v%%", q, got, exact, 100*sketchRelativeAccuracy)
+				}
+			}
+		})
+	}
+}
+
+func TestDDSketchEdgeCases(t *testing.T) {
+	if got := newDDSketch().Quantile(0.5); got != 0 {
+		t.Errorf("empty sketch Quantile = %v, want 0", got)
+	}
+
+	zeros := newDDSketch()
+	zeros.Add(0)
+	zeros.Add(sketchMinValue / 2)
+	zeros.Add(1)
+	if zeros.ZeroCount != 2 {
+		t.Errorf("ZeroCount = %d, want 2", zeros.ZeroCount)
+	}
+	if got := zeros.Quantile(0.5); got != 0 {
+		t.Errorf("Quantile over zero latencies = %v, want 0", got)
+	}
+	if got := zeros.Quantile(1); math.Abs(got-1) > sketchRelativeAccuracy {
+		t.Errorf("Quantile(1) = %v, want about 1", got)
+	}
+}
+
+func TestDDSketchMerge(t *testing.T) {
+	random := rand.New(rand.NewSource(2))
+	a, b, all := newDDSketch(), newDDSketch(), newDDSketch()
+	for i := 0; i < 5000; i++ {
+		value := random.ExpFloat64()
+		all.Add(value)
+		if i%2 == 0 {
+			a.Add(value)
+		} else {
+			b.Add(value)
+		}
+	}
+	a.Merge(b)
+
+	if !reflect.DeepEqual(a.Bins, all.Bins) || a.Count != all.Count || a.Min != all.Min || a.Max != all.Max {
+		t.Error("merged sketch differs from the sketch of all values")
+	}
+	if math.Abs(a.Sum-all.Sum) > 1e-9 {
+		t.Errorf("merged sum = %v, want %v", a.Sum, all.Sum)
+	}
+}
+
+func TestDDSketchBoundsBins(t *testing.T) {
+	sketch := newDDSketch()
+	for exponent := -6.0; exponent < 6; exponent += 0.001 {
+		sketch.Add(math.Pow(10, exponent))
+	}
+	if len(sketch.Bins) > sketchMaxBins {
+		t.Errorf("sketch holds %d bins, want at most %d", len(sketch.Bins), sketchMaxBins)
+	}
+	// Collapsing the lowest bins leaves the high quantiles accurate
+	if got, want := sketch.Quantile(0.99), math.Pow(10, -6+0.99*12); math.Abs(got-want) > 2*sketchRelativeAccuracy*want {
+		t.Errorf("Quantile(0.99) = %v, want about %v", got, want)
+	}
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	// sloSlotSize is the resolution of SLO event counts
+	sloSlotSize = 5 * time.Minute
+	// defaultSLOWindow is the compliance period of an SLO without Window
+	defaultSLOWindow = 30 * 24 * time.Hour
+)
+
+// sloBurnRateWindows are the standard multi-window burn rate alerting windows
+var sloBurnRateWindows = []statsWindow{
+	{label: "1h", length: time.Hour},
+	{label: "6h", length: 6 * time.Hour},
+	{label: "3d", length: 3 * 24 * time.Hour},
+}
+
+var (
+	slos = &sloEngine{states: make(map[string]*sloState)}
+
+	sloGauges = registerSLOCollector()
+)
+
+// SLOConfig declares a service level objective over the requests of a service.
+// A request is good when it meets every configured criterion.
+type SLOConfig struct {
+	Name      string   `json:"Name"`
+	Namespace string   `json:"Namespace"`
+	Service   string   `json:"Service"`
+	Endpoints []string `json:"Endpoints"` // reported request paths, all endpoints if empty
+	Methods   []string `json:"Methods"`   // all methods if empty
+	// Objective is the percentage of good requests, e.g. 99.9
+	Objective float64 `json:"Objective"`
+	// Latency makes requests slower than this duration bad, e.g. 300ms
+	Latency string `json:"Latency"`
+	// Availability makes 5xx responses bad
+	Availability bool `json:"Availability"`
+	// Window is the rolling compliance period, 30d by default
+	Window string `json:"Window"`
+
+	service   string
+	endpoints map[string]bool
+	methods   map[string]bool
+	latency   float64
+	window    time.Duration
+	// key identifies the definition the events are counted by, a change to
+	// anything but the objective restarts the counts
+	key string
+}
+
+// Matches reports whether a request to the endpoint counts towards the SLO
+func (s *SLOConfig) Matches(endpoint, method string) bool {
+	if len(s.endpoints) > 0 && !s.endpoints[endpoint] {
+		return false
+	}
+	return len(s.methods) == 0 || s.methods[strings.ToUpper(method)]
+}
+
+// Good reports whether a request meets the SLO's criteria
+func (s *SLOConfig) Good(duration float64, status int) bool {
+	if s.Availability && status >= 500 {
+		return false
+	}
+	return s.latency <= 0 || duration <= s.latency
+}
+
+// errorBudget is the ratio of requests that may be bad
+func (s *SLOConfig) errorBudget() float64 {
+	return 1 - s.Objective/100
+}
+
+// compileSLOs validates the SLOs and returns them indexed by service key.
+// Invalid SLOs are ignored with a warning.
+func compileSLOs(definitions []SLOConfig) ([]SLOConfig, map[string][]*SLOConfig) {
+	compiled := make([]SLOConfig, 0, len(definitions))
+	names := make(map[string]bool)
+	for _, slo := range definitions {
+		if err := slo.compile(); err != nil {
+			logger.Warnf("Invalid SLO '%s': %v - it will be ignored", slo.Name, err)
+			continue
+		}
+		if names[slo.Name] {
+			logger.Warnf("Duplicate SLO '%s' - it will be ignored", slo.Name)
+			continue
+		}
+		names[slo.Name] = true
+		compiled = append(compiled, slo)
+	}
+
+	byService := make(map[string][]*SLOConfig)
+	for i := range compiled {
+		slo := &compiled[i]
+		byService[slo.service] = append(byService[slo.service], slo)
+	}
+	return compiled, byService
+}
+
+func (s *SLOConfig) compile() error {
+	if s.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if s.Service == "" {
+		return fmt.Errorf("service is required")
+	}
+	if s.Objective <= 0 || s.Objective >= 100 {
+		return fmt.Errorf("objective %v needs to be between 0 and 100", s.Objective)
+	}
+	if s.Latency == "" && !s.Availability {
+		return fmt.Errorf("latency or availability is required")
+	}
+	if s.Latency != "" {
+		latency, err := time.ParseDuration(s.Latency)
+		if err != nil || latency <= 0 {
+			return fmt.Errorf("invalid latency '%s'", s.Latency)
+		}
+		s.latency = latency.Seconds()
+	}
+	s.window = defaultSLOWindow
+	if s.Window != "" {
+		window, err := parseLongDuration(s.Window)
+		if err != nil || window < sloSlotSize {
+			return fmt.Errorf("invalid window '%s' - it needs to be a duration of at least %s", s.Window, sloSlotSize)
+		}
+		s.window = window
+	}
+
+	s.service = BuildServiceName(normalizeTraefikName(s.Namespace), normalizeTraefikName(s.Service), "-")
+	s.endpoints = make(map[string]bool, len(s.Endpoints))
+	for _, endpoint := range s.Endpoints {
+		s.endpoints[endpoint] = true
+	}
+	s.methods = make(map[string]bool, len(s.Methods))
+	for _, method := range s.Methods {
+		s.methods[strings.ToUpper(method)] = true
+	}
+
+	endpoints := make([]string, 0, len(s.endpoints))
+	for endpoint := range s.endpoints {
+		endpoints = append(endpoints, endpoint)
+	}
+	methods := make([]string, 0, len(s.methods))
+	for method := range s.methods {
+		methods = append(methods, method)
+	}
+	sort.Strings(endpoints)
+	sort.Strings(methods)
+	s.key = fmt.Sprintf("%s|%s|%q|%q|%v|%v|%s", s.Name, s.service, endpoints, methods, s.latency, s.Availability, s.window)
+	return nil
+}
+
+// parseLongDuration parses a duration that may also be given in days, e.g. 30d
+func parseLongDuration(value string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(value, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number of days '%s': %w", days, err)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// sloSlot counts the events of one slot of an SLO
+type sloSlot struct {
+	index int64 // slot number since the epoch, identifies stale slots
+	good  int64
+	total int64
+}
+
+// sloState holds the event counts of an SLO as a ring of slots long enough for
+// both its window and the burn rate windows
+type sloState struct {
+	slots []sloSlot
+}
+
+func newSLOState(window time.Duration) *sloState {
+	length := window
+	for _, bw := range sloBurnRateWindows {
+		if bw.length > length {
+			length = bw.length
+		}
+	}
+	return &sloState{slots: make([]sloSlot, (length+sloSlotSize-1)/sloSlotSize)}
+}
+
+func (st *sloState) observe(now time.Time, good bool) {
+	index := now.UnixNano() / int64(sloSlotSize)
+	slot := &st.slots[index%int64(len(st.slots))]
+	if slot.index != index {
+		*slot = sloSlot{index: index}
+	}
+	slot.total++
+	if good {
+		slot.good++
+	}
+}
+
+// events returns the good and total events within length before now
+func (st *sloState) events(now time.Time, length time.Duration) (good, total int64) {
+	current := now.UnixNano() / int64(sloSlotSize)
+	slots := int64((length + sloSlotSize - 1) / sloSlotSize)
+	for i := range st.slots {
+		slot := &st.slots[i]
+		if slot.total == 0 || current-slot.index >= slots {
+			continue
+		}
+		good += slot.good
+		total += slot.total
+	}
+	return good, total
+}
+
+// sloEngine counts good and total events of every configured SLO
+type sloEngine struct {
+	mu     sync.Mutex
+	states map[string]*sloState // by SLOConfig key
+}
+
+// Observe counts a request against the SLOs of its service
+func (e *sloEngine) Observe(config *TraefikOfficerConfig, service, endpoint, method string, duration float64, status int) {
+	definitions := config.SLOsFor(service)
+	if len(definitions) == 0 {
+		return
+	}
+	now := time.Now()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, slo := range definitions {
+		if !slo.Matches(endpoint, method) {
+			continue
+		}
+		e.state(slo).observe(now, slo.Good(duration, status))
+	}
+}
+
+// state returns the counts of the SLO, which start over when its definition
+// changes. The caller holds the lock.
+func (e *sloEngine) state(slo *SLOConfig) *sloState {
+	st, exists := e.states[slo.key]
+	if !exists {
+		st = newSLOState(slo.window)
+		e.states[slo.key] = st
+	}
+	return st
+}
+
+// sloWindowStatus is the compliance of an SLO over one window
+type sloWindowStatus struct {
+	Window     string  `json:"window"`
+	GoodEvents int64   `json:"good_events"`
+	Events     int64   `json:"events"`
+	BurnRate   float64 `json:"burn_rate"`
+}
+
+// sloStatus is the compliance of an SLO, as served at /slos
+type sloStatus struct {
+	Name                 string            `json:"name"`
+	App                  string            `json:"app"`
+	Endpoints            []string          `json:"endpoints,omitempty"`
+	Methods              []string          `json:"methods,omitempty"`
+	Objective            float64           `json:"objective"`
+	Latency              string            `json:"latency,omitempty"`
+	Availability         bool              `json:"availability"`
+	Window               string            `json:"window"`
+	GoodEvents           int64             `json:"good_events"`
+	Events               int64             `json:"events"`
+	ErrorBudgetRemaining float64           `json:"error_budget_remaining"`
+	BurnRates            []sloWindowStatus `json:"burn_rates"`
+}
+
+// Status computes the compliance of every configured SLO
+func (e *sloEngine) Status(config *TraefikOfficerConfig) []sloStatus {
+	now := time.Now()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// Drop the counts of SLOs that were removed or redefined
+	configured := make(map[string]bool, len(config.SLOs))
+	for i := range config.SLOs {
+		configured[config.SLOs[i].key] = true
+	}
+	for key := range e.states {
+		if !configured[key] {
+			delete(e.states, key)
+		}
+	}
+
+	statuses := make([]sloStatus, 0, len(config.SLOs))
+	for i := range config.SLOs {
+		slo := &config.SLOs[i]
+		st := e.state(slo)
+		good, total := st.events(now, slo.window)
+		status := sloStatus{
+			Name:                 slo.Name,
+			App:                  slo.service,
+			Endpoints:            slo.Endpoints,
+			Methods:              slo.Methods,
+			Objective:            slo.Objective,
+			Latency:              slo.Latency,
+			Availability:         slo.Availability,
+			Window:               sloWindowLabel(slo),
+			GoodEvents:           good,
+			Events:               total,
+			ErrorBudgetRemaining: 1,
+		}
+		if total > 0 {
+			// Negative once more requests failed than the budget allows
+			status.ErrorBudgetRemaining = 1 - float64(total-good)/(slo.errorBudget()*float64(total))
+		}
+		for _, bw := range sloBurnRateWindows {
+			good, total := st.events(now, bw.length)
+			window := sloWindowStatus{Window: bw.label, GoodEvents: good, Events: total}
+			if total > 0 {
+				window.BurnRate = float64(total-good) / float64(total) / slo.errorBudget()
+			}
+			status.BurnRates = append(status.BurnRates, window)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+func sloWindowLabel(slo *SLOConfig) string {
+	if slo.Window == "" {
+		return "30d"
+	}
+	return slo.Window
+}
+
+// SLOsFor returns the SLOs of the service
+func (c *TraefikOfficerConfig) SLOsFor(service string) []*SLOConfig {
+	return c.slosByService[service]
+}
+
+// sloCollector exports the SLO compliance computed when collected
+type sloCollector struct {
+	objective  *prometheus.Desc
+	goodEvents *prometheus.Desc
+	events     *prometheus.Desc
+	budget     *prometheus.Desc
+	burnRate   *prometheus.Desc
+}
+
+// registerSLOCollector creates the collector and registers it with the default registry
+func registerSLOCollector() *sloCollector {
+	labels := []string{"slo", "app"}
+	windowed := []string{"slo", "app", "window"}
+	c := &sloCollector{
+		objective: prometheus.NewDesc("traefik_officer_slo_objective_ratio",
+			"Ratio of good requests the SLO aims for", labels, nil),
+		goodEvents: prometheus.NewDesc("traefik_officer_slo_good_events",
+			"Requests meeting the SLO over the window", windowed, nil),
+		events: prometheus.NewDesc("traefik_officer_slo_events",
+			"Requests counted towards the SLO over the window", windowed, nil),
+		budget: prometheus.NewDesc("traefik_officer_slo_error_budget_remaining_ratio",
+			"Ratio of the error budget left over the SLO window, negative once exhausted", labels, nil),
+		burnRate: prometheus.NewDesc("traefik_officer_slo_burn_rate",
+			"Rate the error budget is consumed at over the window, 1 spends exactly the budget", windowed, nil),
+	}
+	prometheus.MustRegister(c)
+	return c
+}
+
+func (c *sloCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.objective
+	ch <- c.goodEvents
+	ch <- c.events
+	ch <- c.budget
+	ch <- c.burnRate
+}
+
+func (c *sloCollector) Collect(ch chan<- prometheus.Metric) {
+	gauge := func(desc *prometheus.Desc, value float64, lvs ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, lvs...)
+	}
+
+	for _, status := range slos.Status(CurrentConfig()) {
+		gauge(c.objective, status.Objective/100, status.Name, status.App)
+		gauge(c.goodEvents, float64(status.GoodEvents), status.Name, status.App, status.Window)
+		gauge(c.events, float64(status.Events), status.Name, status.App, status.Window)
+		gauge(c.budget, status.ErrorBudgetRemaining, status.Name, status.App)
+		for _, window := range status.BurnRates {
+			// The SLO window is already exported above if it is also a burn rate window
+			if window.Window != status.Window {
+				gauge(c.goodEvents, float64(window.GoodEvents), status.Name, status.App, window.Window)
+				gauge(c.events, float64(window.Events), status.Name, status.App, window.Window)
+			}
+			gauge(c.burnRate, window.BurnRate, status.Name, status.App, window.Window)
+		}
+	}
+}
+
+// SLOsHandler serves the compliance of every configured SLO
+func SLOsHandler(w http.ResponseWriter, r *http.Request) {
+	statuses := slos.Status(CurrentConfig())
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(statuses)
+}
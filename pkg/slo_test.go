@@ -0,0 +1,220 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSLOConfigCompile(t *testing.T) {
+	tests := []struct {
+		name        string
+		slo         SLOConfig
+		wantErr     bool
+		wantLatency float64
+		wantWindow  time.Duration
+	}{
+		{name: "latency", slo: SLOConfig{Name: "fast", Namespace: "shop", Service: "store", Objective: 99, Latency: "300ms"}, wantLatency: 0.3, wantWindow: defaultSLOWindow},
+		{name: "availability over days", slo: SLOConfig{Name: "up", Service: "store", Objective: 99.9, Availability: true, Window: "7d"}, wantWindow: 7 * 24 * time.Hour},
+		{name: "window as a duration", slo: SLOConfig{Name: "up", Service: "store", Objective: 99.9, Availability: true, Window: "12h"}, wantWindow: 12 * time.Hour},
+		{name: "window of a single slot", slo: SLOConfig{Name: "up", Service: "store", Objective: 99.9, Availability: true, Window: "5m"}, wantWindow: sloSlotSize},
+		{name: "missing name", slo: SLOConfig{Service: "store", Objective: 99, Availability: true}, wantErr: true},
+		{name: "missing service", slo: SLOConfig{Name: "up", Objective: 99, Availability: true}, wantErr: true},
+		{name: "objective of zero", slo: SLOConfig{Name: "up", Service: "store", Availability: true}, wantErr: true},
+		{name: "objective of 100", slo: SLOConfig{Name: "up", Service: "store", Objective: 100, Availability: true}, wantErr: true},
+		{name: "no criteria", slo: SLOConfig{Name: "up", Service: "store", Objective: 99}, wantErr: true},
+		{name: "invalid latency", slo: SLOConfig{Name: "fast", Service: "store", Objective: 99, Latency: "quick"}, wantErr: true},
+		{name: "negative latency", slo: SLOConfig{Name: "fast", Service: "store", Objective: 99, Latency: "-1s"}, wantErr: true},
+		{name: "invalid days", slo: SLOConfig{Name: "up", Service: "store", Objective: 99, Availability: true, Window: "ad"}, wantErr: true},
+		{name: "window shorter than a slot", slo: SLOConfig{Name: "up", Service: "store", Objective: 99, Availability: true, Window: "1m"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.slo.compile()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("compile() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.slo.latency != tt.wantLatency || tt.slo.window != tt.wantWindow {
+				t.Errorf("compile() = latency %v and window %s, want %v and %s", tt.slo.latency, tt.slo.window, tt.wantLatency, tt.wantWindow)
+			}
+		})
+	}
+}
+
+func TestSLOConfigMatchesAndGood(t *testing.T) {
+	slo := SLOConfig{Name: "checkout", Service: "store", Objective: 99, Latency: "500ms", Availability: true, Endpoints: []string{"/checkout"}, Methods: []string{"post"}}
+	if err := slo.compile(); err != nil {
+		t.Fatalf("compile() error = %v", err)
+	}
+	all := SLOConfig{Name: "all", Service: "store", Objective: 99, Latency: "500ms"}
+	if err := all.compile(); err != nil {
+		t.Fatalf("compile() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		slo      *SLOConfig
+		endpoint string
+		method   string
+		duration float64
+		status   int
+		matches  bool
+		good     bool
+	}{
+		{name: "fast success", slo: &slo, endpoint: "/checkout", method: "POST", duration: 0.1, status: 201, matches: true, good: true},
+		{name: "method case", slo: &slo, endpoint: "/checkout", method: "post", duration: 0.5, status: 200, matches: true, good: true},
+		{name: "slow success", slo: &slo, endpoint: "/checkout", method: "POST", duration: 0.6, status: 200, matches: true},
+		{name: "fast server error", slo: &slo, endpoint: "/checkout", method: "POST", duration: 0.1, status: 503, matches: true},
+		{name: "client error", slo: &slo, endpoint: "/checkout", method: "POST", duration: 0.1, status: 404, matches: true, good: true},
+		{name: "other method", slo: &slo, endpoint: "/checkout", method: "GET", duration: 0.1, status: 200, good: true},
+		{name: "other endpoint", slo: &slo, endpoint: "/cart", method: "POST", duration: 0.1, status: 200, good: true},
+		{name: "latency only ignores errors", slo: &all, endpoint: "/cart", method: "GET", duration: 0.1, status: 500, matches: true, good: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.slo.Matches(tt.endpoint, tt.method); got != tt.matches {
+				t.Errorf("Matches(%q, %q) = %v, want %v", tt.endpoint, tt.method, got, tt.matches)
+			}
+			if got := tt.slo.Good(tt.duration, tt.status); got != tt.good {
+				t.Errorf("Good(%v, %d) = %v, want %v", tt.duration, tt.status, got, tt.good)
+			}
+		})
+	}
+}
+
+func TestSLOStateEvents(t *testing.T) {
+	start := time.Unix(1700000100, 0).Truncate(sloSlotSize)
+	st := newSLOState(time.Hour)
+	// Long enough for the 3d burn rate window
+	if len(st.slots) != 864 {
+		t.Fatalf("slots = %d, want 864", len(st.slots))
+	}
+	st.observe(start, true)
+	st.observe(start.Add(time.Minute), false)
+	st.observe(start.Add(sloSlotSize), true)
+	// Three days later the ring wraps around to the first slot
+	wrapped := start.Add(3 * 24 * time.Hour)
+
+	tests := []struct {
+		name      string
+		observe   bool // a bad event at now before counting
+		now       time.Time
+		length    time.Duration
+		wantGood  int64
+		wantTotal int64
+	}{
+		{name: "current slot", now: start.Add(6 * time.Minute), length: sloSlotSize, wantGood: 1, wantTotal: 1},
+		{name: "both slots", now: start.Add(6 * time.Minute), length: time.Hour, wantGood: 2, wantTotal: 3},
+		{name: "first slot expired", now: start.Add(time.Hour + time.Minute), length: time.Hour, wantGood: 1, wantTotal: 1},
+		{name: "slot reused", observe: true, now: wrapped, length: 3 * 24 * time.Hour, wantGood: 1, wantTotal: 2},
+		{name: "only the reused slot", now: wrapped, length: time.Hour, wantGood: 0, wantTotal: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.observe {
+				st.observe(tt.now, false)
+			}
+			good, total := st.events(tt.now, tt.length)
+			if good != tt.wantGood || total != tt.wantTotal {
+				t.Errorf("events = %d of %d, want %d of %d", good, total, tt.wantGood, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestSLOEngineStatus(t *testing.T) {
+	config := &TraefikOfficerConfig{SLOs: []SLOConfig{
+		{Name: "available", Namespace: "shop", Service: "store", Objective: 99.9, Availability: true},
+		{Name: "fast", Namespace: "shop", Service: "store", Objective: 90, Latency: "100ms", Window: "1h"},
+	}}
+	config.compile()
+	service := config.SLOs[0].service
+	engine := &sloEngine{states: make(map[string]*sloState)}
+
+	for i := 0; i < 1000; i++ {
+		status, duration := 200, 0.05
+		if i < 2 {
+			status = 503
+		}
+		if i%10 == 0 {
+			duration = 0.2
+		}
+		engine.Observe(config, service, "/items", "GET", duration, status)
+	}
+
+	statuses := engine.Status(config)
+	if len(statuses) != 2 {
+		t.Fatalf("statuses = %d, want 2", len(statuses))
+	}
+	tests := []struct {
+		status     sloStatus
+		wantGood   int64
+		wantBudget float64
+		wantBurn   float64
+		wantWindow string
+	}{
+		// Two failures against a budget of one
+		{status: statuses[0], wantGood: 998, wantBudget: -1, wantBurn: 2, wantWindow: "30d"},
+		// A hundred slow requests, exactly the budget
+		{status: statuses[1], wantGood: 900, wantBudget: 0, wantBurn: 1, wantWindow: "1h"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status.Name, func(t *testing.T) {
+			if tt.status.GoodEvents != tt.wantGood || tt.status.Events != 1000 || tt.status.Window != tt.wantWindow {
+				t.Errorf("events = %d of %d over %s, want %d of 1000 over %s", tt.status.GoodEvents, tt.status.Events, tt.status.Window, tt.wantGood, tt.wantWindow)
+			}
+			if math.Abs(tt.status.ErrorBudgetRemaining-tt.wantBudget) > 1e-9 {
+				t.Errorf("ErrorBudgetRemaining = %v, want %v", tt.status.ErrorBudgetRemaining, tt.wantBudget)
+			}
+			if len(tt.status.BurnRates) != len(sloBurnRateWindows) {
+				t.Fatalf("burn rates = %d, want %d", len(tt.status.BurnRates), len(sloBurnRateWindows))
+			}
+			for _, window := range tt.status.BurnRates {
+				if math.Abs(window.BurnRate-tt.wantBurn) > 1e-9 {
+					t.Errorf("%s burn rate = %v, want %v", window.Window, window.BurnRate, tt.wantBurn)
+				}
+			}
+		})
+	}
+}
+
+func TestSLOEngineRedefinition(t *testing.T) {
+	compile := func(slos ...SLOConfig) *TraefikOfficerConfig {
+		config := &TraefikOfficerConfig{SLOs: slos}
+		config.compile()
+		return config
+	}
+	fast := SLOConfig{Name: "fast", Namespace: "shop", Service: "store", Objective: 99, Latency: "100ms"}
+	config := compile(fast, SLOConfig{Name: "up", Namespace: "shop", Service: "store", Objective: 99, Availability: true})
+	service := config.SLOs[0].service
+	engine := &sloEngine{states: make(map[string]*sloState)}
+	engine.Observe(config, service, "/items", "GET", 0.05, 200)
+
+	// A new objective keeps the counts, a new latency starts them over and
+	// the removed SLO is forgotten
+	tests := []struct {
+		name       string
+		fast       SLOConfig
+		wantEvents int64
+	}{
+		{name: "objective changed", fast: SLOConfig{Name: "fast", Namespace: "shop", Service: "store", Objective: 99.5, Latency: "100ms"}, wantEvents: 1},
+		{name: "latency changed", fast: SLOConfig{Name: "fast", Namespace: "shop", Service: "store", Objective: 99.5, Latency: "200ms"}, wantEvents: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statuses := engine.Status(compile(tt.fast))
+			if len(statuses) != 1 || statuses[0].Events != tt.wantEvents {
+				t.Fatalf("statuses = %+v, want fast with %d events", statuses, tt.wantEvents)
+			}
+			if len(engine.states) != 1 {
+				t.Errorf("states = %d, want only those of fast", len(engine.states))
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Response sources, see classifyResponseSource
+const (
+	sourceBackend         = "backend"
+	sourceTraefik         = "traefik"
+	sourceNoBackend       = "no_backend"
+	sourceConnectionError = "connection_error"
+	sourceTimeout         = "timeout"
+)
+
+var responsesBySource = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "traefik_officer_responses_total",
+		Help: "Total number of HTTP responses by where they came from: backend, traefik, no_backend, connection_error or timeout",
+	},
+	[]string{"app", "response_source", "response_code"},
+)
+
+// Status returns the status sent to the client. Only JSON logs tell it apart
+// from the backend's status, the status of CLF logs is already the downstream one.
+func (e *traefikLogConfig) Status() int {
+	if e.DownstreamStatus > 0 {
+		return e.DownstreamStatus
+	}
+	return e.OriginStatus
+}
+
+// classifyResponseSource tells whether the response came from the backend or
+// was generated by Traefik, either by a middleware such as rate limiting or
+// forward auth, or because no backend answered
+func classifyResponseSource(entry *traefikLogConfig) string {
+	status := entry.Status()
+	hasBackend := entry.ServiceURL.selected()
+
+	// JSON logs have OriginStatus 0 whenever the backend did not respond.
+	// CLF logs only show whether a backend was selected.
+	if entry.fromJSON && entry.OriginStatus > 0 || !entry.fromJSON && hasBackend {
+		return sourceBackend
+	}
+
+	switch status {
+	case http.StatusGatewayTimeout:
+		return sourceTimeout
+	case http.StatusBadGateway:
+		if hasBackend {
+			return sourceConnectionError
+		}
+		return sourceNoBackend
+	case http.StatusServiceUnavailable:
+		return sourceNoBackend
+	default:
+		return sourceTraefik
+	}
+}
+
+// updateSourceMetrics counts a response by where it came from
+func updateSourceMetrics(entry *traefikLogConfig, service, code string) {
+	source := classifyResponseSource(entry)
+	responsesBySource.WithLabelValues(service, source, code).Inc()
+	series.Touch("responses_total", responsesBySource, service, source, code)
+}
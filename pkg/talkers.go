@@ -0,0 +1,391 @@
+package main
+
+import (
+	"container/heap"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultTopTalkersK        = 20
+	defaultTopTalkersCapacity = 1000
+	defaultTopTalkersHalfLife = time.Hour
+)
+
+// Top talker rankings
+const (
+	talkersByRequests = "requests"
+	talkersByErrors   = "errors"
+	talkersByBytes    = "bytes"
+)
+
+var (
+	talkerRankings = []string{talkersByRequests, talkersByErrors, talkersByBytes}
+
+	topTalkers = &talkerTracker{}
+
+	topTalkerGauges = registerTopTalkersCollector()
+)
+
+// TopTalkersConfig enables the ranking of clients by requests, errors and bytes
+type TopTalkersConfig struct {
+	Enabled bool `json:"Enabled"`
+	// K is the number of clients per ranking exported as metrics, 20 by default
+	K int `json:"K"`
+	// Capacity is the number of clients tracked per ranking and served at /clients, 1000 by default
+	Capacity int `json:"Capacity"`
+	// IPv4PrefixLength and IPv6PrefixLength group clients by network, 32 and 128 by default
+	IPv4PrefixLength int `json:"IPv4PrefixLength"`
+	IPv6PrefixLength int `json:"IPv6PrefixLength"`
+	// TrustedProxies are the addresses or CIDRs whose X-Forwarded-For is followed to the real client
+	TrustedProxies []string `json:"TrustedProxies"`
+	// HalfLife is how often the counts are halved so the rankings follow recent traffic, 1h by default
+	HalfLife string `json:"HalfLife"`
+
+	trustedProxies []netip.Prefix
+	halfLife       time.Duration
+}
+
+func (t *TopTalkersConfig) compile() {
+	if !t.Enabled {
+		return
+	}
+	if t.K <= 0 {
+		t.K = defaultTopTalkersK
+	}
+	if t.Capacity <= 0 {
+		t.Capacity = defaultTopTalkersCapacity
+	}
+	t.Capacity = max(t.Capacity, t.K)
+	t.halfLife = defaultTopTalkersHalfLife
+	if t.HalfLife != "" {
+		halfLife, err := parseLongDuration(t.HalfLife)
+		if err != nil || halfLife <= 0 {
+			logger.Warnf("Invalid TopTalkers HalfLife '%s' - it needs to be a positive duration, using %s", t.HalfLife, defaultTopTalkersHalfLife)
+		} else {
+			t.halfLife = halfLife
+		}
+	}
+	if t.IPv4PrefixLength <= 0 || t.IPv4PrefixLength > 32 {
+		t.IPv4PrefixLength = 32
+	}
+	if t.IPv6PrefixLength <= 0 || t.IPv6PrefixLength > 128 {
+		t.IPv6PrefixLength = 128
+	}
+	t.trustedProxies = make([]netip.Prefix, 0, len(t.TrustedProxies))
+	for _, proxy := range t.TrustedProxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				logger.Warnf("Invalid TrustedProxies entry '%s': %v - it will be ignored", proxy, err)
+				continue
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		t.trustedProxies = append(t.trustedProxies, prefix.Masked())
+	}
+}
+
+func (t *TopTalkersConfig) trusted(addr netip.Addr) bool {
+	for _, prefix := range t.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClientAddr parses an address that may carry a port
+func parseClientAddr(value string) (netip.Addr, bool) {
+	value = strings.TrimSpace(value)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// Client returns the client a request is attributed to. Starting from the
+// connecting address, X-Forwarded-For is followed from right to left for as
+// long as the hops are trusted proxies. The address is then grouped by network.
+func (t *TopTalkersConfig) Client(entry *traefikLogConfig) string {
+	client, ok := parseClientAddr(entry.ClientHost)
+	if !ok {
+		return entry.ClientHost
+	}
+	if t.trusted(client) && entry.ForwardedFor != "" {
+		hops := strings.Split(entry.ForwardedFor, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop, ok := parseClientAddr(hops[i])
+			if !ok {
+				break
+			}
+			client = hop
+			if !t.trusted(hop) {
+				break
+			}
+		}
+	}
+
+	bits := t.IPv6PrefixLength
+	if client.Is4() {
+		bits = t.IPv4PrefixLength
+	}
+	if bits >= client.BitLen() {
+		return client.String()
+	}
+	prefix, err := client.Prefix(bits)
+	if err != nil {
+		return client.String()
+	}
+	return prefix.String()
+}
+
+// talkerCounter is a client's count in a space-saving summary. The true count
+// lies between Count-Error and Count.
+type talkerCounter struct {
+	Client string `json:"client"`
+	Count  int64  `json:"count"`
+	Error  int64  `json:"error"`
+	index  int
+}
+
+// spaceSaving is a space-saving summary: it counts a fixed number of clients
+// and a new client replaces the smallest, inheriting its count as error bound
+type spaceSaving struct {
+	capacity int
+	counters map[string]*talkerCounter
+	minHeap  talkerHeap
+}
+
+func newSpaceSaving(capacity int) *spaceSaving {
+	return &spaceSaving{capacity: capacity, counters: make(map[string]*talkerCounter, capacity)}
+}
+
+func (ss *spaceSaving) Add(client string, weight int64) {
+	if counter, exists := ss.counters[client]; exists {
+		counter.Count += weight
+		heap.Fix(&ss.minHeap, counter.index)
+		return
+	}
+	if len(ss.counters) < ss.capacity {
+		counter := &talkerCounter{Client: client, Count: weight}
+		ss.counters[client] = counter
+		heap.Push(&ss.minHeap, counter)
+		return
+	}
+
+	smallest := ss.minHeap[0]
+	delete(ss.counters, smallest.Client)
+	smallest.Client, smallest.Error = client, smallest.Count
+	smallest.Count += weight
+	ss.counters[client] = smallest
+	heap.Fix(&ss.minHeap, 0)
+}
+
+// Decay divides every count and error bound by 2^shift, dropping the clients
+// whose count reaches zero to make room for new ones
+func (ss *spaceSaving) Decay(shift uint) {
+	ss.minHeap = ss.minHeap[:0]
+	for client, counter := range ss.counters {
+		counter.Count >>= min(shift, 63)
+		counter.Error >>= min(shift, 63)
+		if counter.Count == 0 {
+			delete(ss.counters, client)
+			continue
+		}
+		counter.index = len(ss.minHeap)
+		ss.minHeap = append(ss.minHeap, counter)
+	}
+	heap.Init(&ss.minHeap)
+}
+
+// Resize changes the number of clients tracked, keeping the largest counts
+func (ss *spaceSaving) Resize(capacity int) {
+	top := ss.Top(capacity)
+	*ss = *newSpaceSaving(capacity)
+	for i := range top {
+		counter := &top[i]
+		ss.counters[counter.Client] = counter
+		heap.Push(&ss.minHeap, counter)
+	}
+}
+
+// Top returns up to limit counters by decreasing count, all of them if limit is zero
+func (ss *spaceSaving) Top(limit int) []talkerCounter {
+	top := make([]talkerCounter, 0, len(ss.counters))
+	for _, counter := range ss.counters {
+		top = append(top, *counter)
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Client < top[j].Client
+	})
+	if limit > 0 && len(top) > limit {
+		top = top[:limit]
+	}
+	return top
+}
+
+// talkerHeap orders counters by count, smallest first
+type talkerHeap []*talkerCounter
+
+func (h talkerHeap) Len() int           { return len(h) }
+func (h talkerHeap) Less(i, j int) bool { return h[i].Count < h[j].Count }
+func (h talkerHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *talkerHeap) Push(x interface{}) {
+	counter := x.(*talkerCounter)
+	counter.index = len(*h)
+	*h = append(*h, counter)
+}
+
+func (h *talkerHeap) Pop() interface{} {
+	old := *h
+	counter := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return counter
+}
+
+// talkerTracker ranks clients by requests, errors and response bytes
+type talkerTracker struct {
+	mu        sync.Mutex
+	rankings  map[string]*spaceSaving
+	capacity  int
+	decayedAt time.Time
+}
+
+// maintain creates the rankings, resizes them when Capacity changed and halves
+// the counts for every half-life elapsed since the last decay. The caller holds the lock.
+func (tt *talkerTracker) maintain(config *TopTalkersConfig, now time.Time) {
+	if tt.rankings == nil {
+		tt.rankings = make(map[string]*spaceSaving, len(talkerRankings))
+		for _, ranking := range talkerRankings {
+			tt.rankings[ranking] = newSpaceSaving(config.Capacity)
+		}
+		tt.capacity = config.Capacity
+		tt.decayedAt = now
+	}
+	if config.Capacity != tt.capacity {
+		for _, ss := range tt.rankings {
+			ss.Resize(config.Capacity)
+		}
+		tt.capacity = config.Capacity
+	}
+	if config.halfLife <= 0 {
+		return
+	}
+	if halvings := now.Sub(tt.decayedAt) / config.halfLife; halvings > 0 {
+		for _, ss := range tt.rankings {
+			ss.Decay(uint(min(halvings, 63)))
+		}
+		tt.decayedAt = tt.decayedAt.Add(halvings * config.halfLife)
+	}
+}
+
+// Observe counts a request against its client
+func (tt *talkerTracker) Observe(entry *traefikLogConfig, config *TraefikOfficerConfig, status int) {
+	if !config.TopTalkers.Enabled {
+		return
+	}
+	client := config.TopTalkers.Client(entry)
+
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	tt.maintain(&config.TopTalkers, time.Now())
+	tt.rankings[talkersByRequests].Add(client, 1)
+	if status >= 400 {
+		tt.rankings[talkersByErrors].Add(client, 1)
+	}
+	if entry.OriginContentSize > 0 {
+		tt.rankings[talkersByBytes].Add(client, int64(entry.OriginContentSize))
+	}
+}
+
+// Top returns the top limit clients of the ranking, all tracked ones if limit is zero
+func (tt *talkerTracker) Top(ranking string, limit int) []talkerCounter {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	if config := &CurrentConfig().TopTalkers; config.Enabled {
+		tt.maintain(config, time.Now())
+	}
+	if ss, exists := tt.rankings[ranking]; exists {
+		return ss.Top(limit)
+	}
+	return []talkerCounter{}
+}
+
+// topTalkersCollector exports the top K clients of each ranking
+type topTalkersCollector struct {
+	descs map[string]*prometheus.Desc
+}
+
+// registerTopTalkersCollector creates the collector and registers it with the default registry
+func registerTopTalkersCollector() *topTalkersCollector {
+	labels := []string{"client"}
+	c := &topTalkersCollector{descs: map[string]*prometheus.Desc{
+		talkersByRequests: prometheus.NewDesc("traefik_officer_top_client_requests",
+			"Requests of the top clients by requests halved every half-life, an estimate that may exceed the true count by up to the error bound at /clients", labels, nil),
+		talkersByErrors: prometheus.NewDesc("traefik_officer_top_client_errors",
+			"4xx and 5xx responses of the top clients by errors halved every half-life, an estimate that may exceed the true count by up to the error bound at /clients", labels, nil),
+		talkersByBytes: prometheus.NewDesc("traefik_officer_top_client_response_bytes",
+			"Response bytes of the top clients by bytes halved every half-life, an estimate that may exceed the true count by up to the error bound at /clients", labels, nil),
+	}}
+	prometheus.MustRegister(c)
+	return c
+}
+
+func (c *topTalkersCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, ranking := range talkerRankings {
+		ch <- c.descs[ranking]
+	}
+}
+
+func (c *topTalkersCollector) Collect(ch chan<- prometheus.Metric) {
+	config := CurrentConfig()
+	if !config.TopTalkers.Enabled {
+		return
+	}
+	for _, ranking := range talkerRankings {
+		for _, counter := range topTalkers.Top(ranking, config.TopTalkers.K) {
+			ch <- prometheus.MustNewConstMetric(c.descs[ranking], prometheus.GaugeValue, float64(counter.Count), counter.Client)
+		}
+	}
+}
+
+// ClientsHandler serves every tracked client of each ranking with its error
+// bound. The by query parameter selects one ranking and limit caps the clients.
+func ClientsHandler(w http.ResponseWriter, r *http.Request) {
+	rankings := talkerRankings
+	if by := r.URL.Query().Get("by"); by != "" {
+		rankings = []string{by}
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	response := make(map[string][]talkerCounter, len(rankings))
+	for _, ranking := range rankings {
+		response[ranking] = topTalkers.Top(ranking, limit)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSpaceSaving(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		clients  []string
+		limit    int
+		want     []talkerCounter
+	}{
+		{
+			name:     "exact within capacity",
+			capacity: 3,
+			clients:  []string{"a", "b", "a", "c", "a", "b"},
+			want:     []talkerCounter{{Client: "a", Count: 3}, {Client: "b", Count: 2}, {Client: "c", Count: 1}},
+		},
+		{
+			name:     "new client inherits the smallest count as error",
+			capacity: 2,
+			clients:  []string{"a", "a", "a", "b", "c"},
+			want:     []talkerCounter{{Client: "a", Count: 3}, {Client: "c", Count: 2, Error: 1}},
+		},
+		{
+			name:     "heavy hitter survives a stream of one-off clients",
+			capacity: 3,
+			clients:  []string{"a", "b", "a", "c", "a", "d", "a", "e", "a", "f"},
+			limit:    1,
+			want:     []talkerCounter{{Client: "a", Count: 5}},
+		},
+		{
+			name:     "ties are ordered by client",
+			capacity: 3,
+			clients:  []string{"c", "b", "a"},
+			limit:    2,
+			want:     []talkerCounter{{Client: "a", Count: 1}, {Client: "b", Count: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss := newSpaceSaving(tt.capacity)
+			for _, client := range tt.clients {
+				ss.Add(client, 1)
+			}
+			got := ss.Top(tt.limit)
+			for i := range got {
+				got[i].index = 0
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Top(%d) = %+v, want %+v", tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpaceSavingDecayAndResize(t *testing.T) {
+	ss := newSpaceSaving(3)
+	ss.Add("a", 8)
+	ss.Add("b", 3)
+	ss.Add("c", 1)
+
+	ss.Decay(1)
+	if got := ss.Top(0); len(got) != 2 || got[0].Count != 4 || got[1].Count != 1 {
+		t.Fatalf("after decay Top = %+v, want a 4 and b 1", got)
+	}
+	// The slot c held is free again
+	ss.Add("d", 1)
+	if _, exists := ss.counters["d"]; !exists || ss.counters["d"].Error != 0 {
+		t.Errorf("d was not added exactly after decay: %+v", ss.counters["d"])
+	}
+
+	ss.Resize(1)
+	if got := ss.Top(0); len(got) != 1 || got[0].Client != "a" {
+		t.Errorf("after shrinking Top = %+v, want only a", got)
+	}
+	ss.Resize(2)
+	ss.Add("e", 1)
+	if got := ss.Top(0); len(got) != 2 || got[1].Client != "e" || got[1].Error != 0 {
+		t.Errorf("after growing Top = %+v, want a and e", got)
+	}
+}
+
+func TestTalkerTrackerMaintain(t *testing.T) {
+	config := &TopTalkersConfig{Enabled: true, Capacity: 4, HalfLife: "1h"}
+	config.compile()
+	start := time.Now()
+
+	tracker := &talkerTracker{}
+	tracker.maintain(config, start)
+	tracker.rankings[talkersByRequests].Add("a", 16)
+
+	tracker.maintain(config, start.Add(59*time.Minute))
+	if got := tracker.rankings[talkersByRequests].counters["a"].Count; got != 16 {
+		t.Errorf("count before a half-life = %d, want 16", got)
+	}
+	tracker.maintain(config, start.Add(2*time.Hour+time.Minute))
+	if got := tracker.rankings[talkersByRequests].counters["a"].Count; got != 4 {
+		t.Errorf("count after two half-lives = %d, want 4", got)
+	}
+	tracker.maintain(config, start.Add(3*time.Hour))
+	if got := tracker.rankings[talkersByRequests].counters["a"].Count; got != 2 {
+		t.Errorf("count after three half-lives = %d, want 2", got)
+	}
+
+	config.Capacity = 10
+	tracker.maintain(config, start.Add(3*time.Hour))
+	for ranking, ss := range tracker.rankings {
+		if ss.capacity != 10 {
+			t.Errorf("%s ranking capacity = %d, want 10", ranking, ss.capacity)
+		}
+	}
+	if got := tracker.rankings[talkersByRequests].counters["a"].Count; got != 2 {
+		t.Errorf("count after resizing = %d, want 2", got)
+	}
+}
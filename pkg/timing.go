@@ -0,0 +1,75 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// overheadBuckets span 0.1ms to 26s, Traefik's own processing is usually far below request latency
+var overheadBuckets = prometheus.ExponentialBuckets(0.0001, 4, 10)
+
+var (
+	overheadDuration = registerHistogramSet(
+		prometheus.HistogramOpts{
+			Name: "traefik_officer_overhead_seconds",
+			Help: "Time spent in Traefik and its middlewares per request in seconds, JSON logs only",
+		},
+		[]string{"app"},
+	)
+
+	endpointOverheadDuration = registerHistogramSet(
+		prometheus.HistogramOpts{
+			Name: "traefik_officer_endpoint_overhead_seconds",
+			Help: "Time spent in Traefik and its middlewares per request and endpoint in seconds, JSON logs only",
+		},
+		[]string{"app", "request_path"},
+	)
+
+	originDuration = registerHistogramSet(
+		prometheus.HistogramOpts{
+			Name: "traefik_officer_origin_duration_seconds",
+			Help: "Time spent waiting for the backend per request in seconds, JSON logs only",
+		},
+		[]string{"app"},
+	)
+
+	endpointOriginDuration = registerHistogramSet(
+		prometheus.HistogramOpts{
+			Name: "traefik_officer_endpoint_origin_duration_seconds",
+			Help: "Time spent waiting for the backend per request and endpoint in seconds, JSON logs only",
+		},
+		[]string{"app", "request_path"},
+	)
+)
+
+// updateTimingMetrics splits the latency of a request into Traefik overhead and
+// backend time. pathLabel is the request_path label the request is counted under.
+func updateTimingMetrics(entry *traefikLogConfig, config *TraefikOfficerConfig, service, pathLabel string) {
+	// Only JSON logs carry the breakdown
+	if !entry.fromJSON {
+		return
+	}
+	overhead := entry.Overhead / 1000.0 // Convert to seconds
+	origin := entry.OriginDuration / 1000.0
+
+	traefikOverhead.Observe(entry.Overhead)
+
+	overheadLayout := histogramLayout{buckets: overheadBuckets, native: config.NativeHistograms}
+	overheadDuration.WithLabelValues(overheadLayout, service).Observe(overhead)
+	endpointOverheadDuration.WithLabelValues(overheadLayout, service, pathLabel).Observe(overhead)
+	series.Touch("overhead_seconds", overheadDuration, service)
+	series.Touch("endpoint_overhead_seconds", endpointOverheadDuration, service, pathLabel)
+
+	originDuration.WithLabelValues(config.LatencyHistogramFor(service, ""), service).Observe(origin)
+	endpointOriginDuration.WithLabelValues(config.LatencyHistogramFor(service, pathLabel), service, pathLabel).Observe(origin)
+	series.Touch("origin_duration_seconds", originDuration, service)
+	series.Touch("endpoint_origin_duration_seconds", endpointOriginDuration, service, pathLabel)
+}
+
+// OverheadRatio is the share of the duration of requests with a known
+// breakdown that was spent in Traefik
+func (s windowSummary) OverheadRatio() float64 {
+	if s.TimedDuration <= 0 {
+		return 0
+	}
+	return s.TotalOverhead / s.TimedDuration
+}
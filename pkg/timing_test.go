@@ -0,0 +1,81 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestUpdateTimingMetrics(t *testing.T) {
+	config := &TraefikOfficerConfig{}
+	config.compile()
+
+	tests := []struct {
+		name         string
+		service      string
+		entry        traefikLogConfig
+		wantCount    uint64
+		wantOverhead float64
+		wantOrigin   float64
+	}{
+		{
+			name:    "common log format has no breakdown",
+			service: "timing-test-clf",
+			entry:   traefikLogConfig{Duration: 250},
+		},
+		{
+			name:         "milliseconds become seconds",
+			service:      "timing-test-json",
+			entry:        traefikLogConfig{Duration: 250, Overhead: 12.5, OriginDuration: 237.5, fromJSON: true},
+			wantCount:    1,
+			wantOverhead: 0.0125,
+			wantOrigin:   0.2375,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(func() {
+				overheadDuration.DeleteLabelValues(tt.service)
+				endpointOverheadDuration.DeleteLabelValues(tt.service, "/items")
+				originDuration.DeleteLabelValues(tt.service)
+				endpointOriginDuration.DeleteLabelValues(tt.service, "/items")
+			})
+			updateTimingMetrics(&tt.entry, config, tt.service, "/items")
+
+			for _, h := range []struct {
+				name string
+				c    *histogramSet
+				lvs  []string
+				want float64
+			}{
+				{name: "overhead", c: overheadDuration, lvs: []string{tt.service}, want: tt.wantOverhead},
+				{name: "endpoint overhead", c: endpointOverheadDuration, lvs: []string{tt.service, "/items"}, want: tt.wantOverhead},
+				{name: "origin", c: originDuration, lvs: []string{tt.service}, want: tt.wantOrigin},
+				{name: "endpoint origin", c: endpointOriginDuration, lvs: []string{tt.service, "/items"}, want: tt.wantOrigin},
+			} {
+				count, sum := histogramSample(t, h.c, h.lvs...)
+				if count != tt.wantCount || math.Abs(sum-h.want) > 1e-9 {
+					t.Errorf("%s = %d summing to %v, want %d summing to %v", h.name, count, sum, tt.wantCount, h.want)
+				}
+			}
+		})
+	}
+}
+
+func TestOverheadRatio(t *testing.T) {
+	tests := []struct {
+		name    string
+		summary windowSummary
+		want    float64
+	}{
+		{name: "no breakdown", summary: windowSummary{Requests: 3, TotalDuration: 1}, want: 0},
+		{name: "share of the timed requests", summary: windowSummary{Requests: 3, TotalDuration: 3, TimedDuration: 2, TotalOverhead: 0.5}, want: 0.25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.summary.OverheadRatio(); got != tt.want {
+				t.Errorf("OverheadRatio() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
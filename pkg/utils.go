@@ -10,7 +10,6 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
-	"sort"
 	"strconv"
 	"strings"
 	"syscall"
@@ -82,6 +81,8 @@ func parseJSON(line string) (traefikLogConfig, error) {
 
 	jsonLog.Duration = jsonLog.Duration / 1000000 // JSON Logs format latency in nanoseconds, convert to ms
 	jsonLog.Overhead = jsonLog.Overhead / 1000000 // sane for overhead metrics
+	jsonLog.OriginDuration = jsonLog.OriginDuration / 1000000
+	jsonLog.fromJSON = true
 
 	logger.Debugf("JSON Parsed: %+v", jsonLog)
 	logger.Debugf("ClientHost: %s", jsonLog.ClientHost)
@@ -91,10 +92,18 @@ func parseJSON(line string) (traefikLogConfig, error) {
 	logger.Debugf("RequestPath: %s", jsonLog.RequestPath)
 	logger.Debugf("RequestProtocol: %s", jsonLog.RequestProtocol)
 	logger.Debugf("OriginStatus: %d", jsonLog.OriginStatus)
+	logger.Debugf("DownstreamStatus: %d", jsonLog.DownstreamStatus)
+	logger.Debugf("ServiceURL: %s", jsonLog.ServiceURL)
+	logger.Debugf("ServiceAddr: %s", jsonLog.ServiceAddr)
+	logger.Debugf("RetryAttempts: %d", jsonLog.RetryAttempts)
 	logger.Debugf("OriginContentSize: %dbytes", jsonLog.OriginContentSize)
+	if jsonLog.RequestContentSize != nil {
+		logger.Debugf("RequestContentSize: %dbytes", *jsonLog.RequestContentSize)
+	}
 	logger.Debugf("RequestCount: %d", jsonLog.RequestCount)
 	logger.Debugf("Duration: %fms", jsonLog.Duration)
 	logger.Debugf("Overhead: %fms", jsonLog.Overhead)
+	logger.Debugf("OriginDuration: %fms", jsonLog.OriginDuration)
 
 	return jsonLog, err
 }
@@ -215,6 +224,7 @@ func parseLine(line string) (traefikLogConfig, error) {
 	}
 
 	log.RouterName = strings.Trim(submatch[12], "\"")
+	log.ServiceURL = backendURL(strings.Trim(submatch[13], "\""))
 
 	// Parse duration
 	latencyStr := strings.Trim(submatch[14], "ms")
@@ -339,87 +349,42 @@ func deleteFile(path string) error {
 	return nil
 }
 
-// Helper function to check if a string is in a slice
-
-func contains(slice []TraefikService, item string) bool {
-	for _, s := range slice {
-		name := BuildServiceName(s.Namespace, s.Name, "-")
-		if name == item {
-			return true
-		}
-	}
-	return false
-}
-
-func startsWith(slice []TraefikService, item string) bool {
-	for _, s := range slice {
-		name := BuildServiceName(s.Namespace, s.Name, "-")
-		if strings.HasPrefix(item, name) {
-			return true
-		}
-	}
-	return false
-}
-
 func updateTopPaths() {
 	logger.Debug("******** Updating top paths... ***********")
-	type pathStat struct {
-		service    string
-		path       string
-		avgLatency float64
-	}
 
-	// Group paths by service
-	servicePaths := make(map[string][]pathStat)
-
-	// Get all paths and their stats
+	// Group the recent windows of the paths by service
+	now := time.Now()
+	servicePaths := make(map[string][]rankedEndpoint)
 	endpointStatsMutex.RLock()
 	for key, stat := range endpointStats {
-		if stat.TotalRequests > 0 {
-			// Split the key into service and path
-			parts := strings.SplitN(key, ":", 2)
-			if len(parts) != 2 {
-				continue
-			}
-			service, path := parts[0], parts[1]
-
-			// Add to service's path list
-			servicePaths[service] = append(servicePaths[service], pathStat{
-				service:    service,
-				path:       path,
-				avgLatency: stat.TotalDuration / float64(stat.TotalRequests),
-			})
+		// Split the key into service and path
+		parts := strings.SplitN(key, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		summary := stat.Recent(now)
+		if summary.Requests == 0 {
+			continue
 		}
+		servicePaths[parts[0]] = append(servicePaths[parts[0]], rankedEndpoint{path: parts[1], summary: summary})
 	}
 	endpointStatsMutex.RUnlock()
 
+	config := CurrentConfig()
+
 	topPathsMutex.Lock()
 	defer topPathsMutex.Unlock()
 
 	// Clear current top paths
 	topPathsPerService = make(map[string]map[string]bool)
 
-	// For each service, find its top N paths
+	// For each service, take the top N paths by each of its ranking criteria
 	for service, paths := range servicePaths {
-		// Sort paths by average latency (highest first)
-		sort.Slice(paths, func(i, j int) bool {
-			return paths[i].avgLatency > paths[j].avgLatency
-		})
-
-		// Take top N paths for this service
-		limit := topNPaths
-		if limit > len(paths) {
-			limit = len(paths)
-		}
+		top := topEndpoints(paths, config.TopNRankingFor(service), config.TopNFor(service), int64(config.TopNMinRequests))
 
-		// Initialize service map if not exists
-		if _, exists := topPathsPerService[service]; !exists {
-			topPathsPerService[service] = make(map[string]bool)
-		}
-
-		// Add top paths for this service
-		for i := 0; i < limit; i++ {
-			pathKey := fmt.Sprintf("%s:%s", service, paths[i].path)
+		topPathsPerService[service] = make(map[string]bool, len(top))
+		for _, path := range top {
+			pathKey := fmt.Sprintf("%s:%s", service, path)
 			topPathsPerService[service][pathKey] = true
 		}
 		logger.Debugf("Updated top paths. Service: %s, Total top paths: %d \n",
@@ -438,8 +403,8 @@ func countTotalTopPaths(tps map[string]map[string]bool) int {
 
 func startTopPathsUpdater(interval time.Duration) {
 	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
 	go func() {
+		defer ticker.Stop()
 		defer func() {
 			if r := recover(); r != nil {
 				logger.Errorf("Recovered in startTopPathsUpdater: %v", r)
@@ -451,44 +416,12 @@ func startTopPathsUpdater(interval time.Duration) {
 	}()
 }
 
-func extractServiceName(routerName string) string {
-	// Remove anything after @ character (including the @ itself)
-	if idx := strings.Index(routerName, "@"); idx != -1 {
-		routerName = routerName[:idx]
-	}
-
-	// Split by dash and try to find a meaningful service name
-	parts := strings.Split(routerName, "-")
-	if len(parts) >= 3 {
-		// Try to identify a service pattern: namespace-service-name-type-protocol-hash
-		for i := 0; i < len(parts)-2; i++ {
-			if parts[i+1] == "api" || parts[i+1] == "web" || parts[i+1] == "service" {
-				if i > 0 {
-					return fmt.Sprintf("%s-%s", parts[i], parts[i+1])
-				}
-				return parts[i+1]
-			}
-		}
-
-		// Fallback: use first 2-3 parts
-		if len(parts) >= 4 {
-			return strings.Join(parts[:3], "-")
-		} else {
-			return strings.Join(parts[:2], "-")
-		}
-	}
-
-	// If parsing fails, return the first part or original
-	if len(parts) > 0 {
-		return parts[0]
-	}
-	return routerName
-}
-
 // normalizeURL applies URL patterns to normalize endpoints
-func normalizeURL(serviceName, path string, urlPatterns []URLPattern) string {
+func normalizeURL(router RouterInfo, method, path string, config *TraefikOfficerConfig) string {
+	serviceName := router.ServiceKey()
+
 	// First, try service-specific patterns
-	for _, pattern := range urlPatterns {
+	for _, pattern := range config.URLPatterns {
 		patternServiceName := BuildServiceName(pattern.Namespace, pattern.ServiceName, "-")
 		if patternServiceName == serviceName && pattern.Regex != nil {
 			if pattern.Regex.MatchString(path) {
@@ -498,8 +431,30 @@ func normalizeURL(serviceName, path string, urlPatterns []URLPattern) string {
 		}
 	}
 
-	// Default normalization - replace IDs and UUIDs
+	// Services with an OpenAPI spec are reported by their documented paths
+	if svc := config.Service(serviceName); svc != nil {
+		if spec := svc.openAPI.Spec(); spec != nil {
+			return normalizeOpenAPI(spec, serviceName, method, path)
+		}
+	}
+
+	// Then the templates of the router's Path, PathPrefix and PathRegexp matchers
 	normalized := path
+	pathPart, query, hasQuery := strings.Cut(path, "?")
+	if templated, complete, ok := routerRules.Apply(router.Name, pathPart); ok {
+		if complete {
+			if hasQuery {
+				return templated + "?{query_params}"
+			}
+			return templated
+		}
+		normalized = templated
+		if hasQuery {
+			normalized += "?" + query
+		}
+	}
+
+	// Default normalization - replace IDs and UUIDs
 
 	// Replace numeric IDs
 	re1 := regexp.MustCompile(`/\d+(/|$|\?)`)
@@ -513,6 +468,15 @@ func normalizeURL(serviceName, path string, urlPatterns []URLPattern) string {
 	re3 := regexp.MustCompile(`/[a-zA-Z0-9]{20,}(/|$|\?)`)
 	normalized = re3.ReplaceAllString(normalized, "/{token}$1")
 
+	// Collapse the segments learned to be variable for this service
+	if templateLearner != nil {
+		pathPart, query, hasQuery := strings.Cut(normalized, "?")
+		normalized = templateLearner.Normalize(serviceName, pathPart)
+		if hasQuery {
+			normalized += "?" + query
+		}
+	}
+
 	// Replace query params
 	re4 := regexp.MustCompile(`\?.*`)
 	normalized = re4.ReplaceAllString(normalized, "?{query_params}")
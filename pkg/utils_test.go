@@ -0,0 +1,82 @@
+package main
+
+import "testing"
+
+func TestParseLineBackend(t *testing.T) {
+	tests := []struct {
+		name        string
+		line        string
+		wantURL     backendURL
+		wantAddress string
+		wantSource  string
+	}{
+		{
+			name:        "JSON with URL object",
+			line:        `{"ClientAddr":"10.42.0.1:53870","ClientHost":"10.42.0.1","ClientPort":"53870","ClientUsername":"-","DownstreamContentSize":2,"DownstreamStatus":200,"Duration":1820493,"OriginContentSize":2,"OriginDuration":1702116,"OriginStatus":200,"Overhead":118377,"RequestAddr":"shop.example.com","RequestContentSize":0,"RequestCount":42,"RequestHost":"shop.example.com","RequestMethod":"GET","RequestPath":"/api/orders/12","RequestPort":"-","RequestProtocol":"HTTP/1.1","RequestScheme":"https","RetryAttempts":0,"RouterName":"shop-store-front@kubernetescrd","ServiceAddr":"10.0.0.5:80","ServiceName":"shop-store-80@kubernetescrd","ServiceURL":{"Scheme":"http","Opaque":"","User":null,"Host":"10.0.0.5:80","Path":"","RawPath":"","OmitHost":false,"ForceQuery":false,"RawQuery":"","Fragment":"","RawFragment":""},"StartLocal":"2024-05-01T10:00:00.123456789Z","StartUTC":"2024-05-01T10:00:00.123456789Z","entryPointName":"websecure","level":"info","msg":"","time":"2024-05-01T10:00:00Z"}`,
+			wantURL:     "http://10.0.0.5:80",
+			wantAddress: "10.0.0.5:80",
+			wantSource:  sourceBackend,
+		},
+		{
+			name:        "JSON with URL object only",
+			line:        `{"ClientHost":"10.42.0.1","DownstreamStatus":502,"Duration":1820493,"OriginStatus":0,"RequestMethod":"GET","RequestPath":"/","RouterName":"shop-store-front@kubernetescrd","ServiceURL":{"Scheme":"http","Opaque":"","User":null,"Host":"10.0.0.6:8080","Path":"","RawPath":"","OmitHost":false,"ForceQuery":false,"RawQuery":"","Fragment":"","RawFragment":""},"StartUTC":"2024-05-01T10:00:00Z"}`,
+			wantURL:     "http://10.0.0.6:8080",
+			wantAddress: "10.0.0.6:8080",
+			wantSource:  sourceConnectionError,
+		},
+		{
+			name:       "JSON without backend",
+			line:       `{"ClientHost":"10.42.0.1","DownstreamStatus":429,"Duration":91034,"OriginStatus":0,"RequestMethod":"GET","RequestPath":"/","RouterName":"shop-store-front@kubernetescrd","StartUTC":"2024-05-01T10:00:00Z"}`,
+			wantSource: sourceTraefik,
+		},
+		{
+			name:       "JSON with null URL",
+			line:       `{"ClientHost":"10.42.0.1","DownstreamStatus":502,"Duration":91034,"OriginStatus":0,"RequestMethod":"GET","RequestPath":"/","ServiceURL":null,"StartUTC":"2024-05-01T10:00:00Z"}`,
+			wantSource: sourceNoBackend,
+		},
+		{
+			name:        "JSON with URL string",
+			line:        `{"ClientHost":"10.42.0.1","DownstreamStatus":200,"Duration":91034,"OriginStatus":200,"RequestMethod":"GET","RequestPath":"/","ServiceURL":"http://10.0.0.7:80","StartUTC":"2024-05-01T10:00:00Z"}`,
+			wantURL:     "http://10.0.0.7:80",
+			wantAddress: "10.0.0.7:80",
+			wantSource:  sourceBackend,
+		},
+		{
+			name:        "CLF with backend",
+			line:        `10.42.0.1 - - [01/May/2024:10:00:00 +0000] "GET /api/orders/12 HTTP/1.1" 502 11 "-" "curl/8.5.0" 42 "shop-store-front@kubernetescrd" "http://10.0.0.5:80" 3ms`,
+			wantURL:     "http://10.0.0.5:80",
+			wantAddress: "10.0.0.5:80",
+			wantSource:  sourceBackend,
+		},
+		{
+			name:       "CLF without backend",
+			line:       `10.42.0.1 - - [01/May/2024:10:00:00 +0000] "GET /api/orders/12 HTTP/1.1" 503 19 "-" "curl/8.5.0" 43 "shop-store-front@kubernetescrd" - 0ms`,
+			wantURL:    "-",
+			wantSource: sourceNoBackend,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var entry traefikLogConfig
+			var err error
+			if tt.line[0] == '{' {
+				entry, err = parseJSON(tt.line)
+			} else {
+				entry, err = parseLine(tt.line)
+			}
+			if err != nil {
+				t.Fatalf("parsing line: %v", err)
+			}
+			if entry.ServiceURL != tt.wantURL {
+				t.Errorf("ServiceURL = %q, want %q", entry.ServiceURL, tt.wantURL)
+			}
+			if got := backendAddress(&entry); got != tt.wantAddress {
+				t.Errorf("backendAddress = %q, want %q", got, tt.wantAddress)
+			}
+			if got := classifyResponseSource(&entry); got != tt.wantSource {
+				t.Errorf("classifyResponseSource = %q, want %q", got, tt.wantSource)
+			}
+		})
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// rankingWindow is how far back endpoint statistics reach for ranking
+	rankingWindow = 5 * time.Minute
+	// windowSlots is the number of slots every sliding window is split into
+	windowSlots = 12
+)
+
+// defaultStatsWindows are used when StatsWindows is not configured
+var defaultStatsWindows = []string{"1m", "5m", "1h"}
+
+// statsWindow is one of the configured StatsWindows
+type statsWindow struct {
+	label  string
+	length time.Duration
+}
+
+// requestObservation is what the sliding windows record of a request
+type requestObservation struct {
+	duration       float64
+	status         int
+	apdexThreshold float64 // Apdex T the request is judged by
+	responseSize   int64   // bytes, zero if unknown
+	detailed       bool    // whether overhead and retry attempts are known, JSON logs only
+	overhead       float64 // seconds spent in Traefik
+	retryAttempts  int
+}
+
+// windowSlot holds the requests of one slot of a sliding window
+type windowSlot struct {
+	index         int64 // slot number since the epoch, identifies stale slots
+	requests      int64
+	errors        int64 // 4xx and 5xx
+	serverErrors  int64 // 5xx
+	satisfied     int64 // Apdex satisfied
+	tolerating    int64 // Apdex tolerating
+	responseBytes int64
+	totalDuration float64
+	maxDuration   float64
+	timedDuration float64 // duration of the requests with a known overhead
+	totalOverhead float64
+	// successes with known retry attempts, and those that needed a retry
+	detailedSuccesses int64
+	retriedSuccesses  int64
+	sketch            *ddSketch
+}
+
+// slidingWindow aggregates requests over a recent period as a ring of slots
+type slidingWindow struct {
+	slotSize time.Duration
+	slots    []windowSlot
+	// rolledUp windows sketch no latencies themselves, their slots get the
+	// sketches of a shorter window's slots through a windowSet
+	rolledUp bool
+}
+
+func newSlidingWindow(length time.Duration, slots int) *slidingWindow {
+	return &slidingWindow{slotSize: length / time.Duration(slots), slots: make([]windowSlot, slots)}
+}
+
+func (w *slidingWindow) length() time.Duration {
+	return w.slotSize * time.Duration(len(w.slots))
+}
+
+func (w *slidingWindow) slotIndex(now time.Time) int64 {
+	return now.UnixNano() / int64(w.slotSize)
+}
+
+// Observe adds a request to the slot of now, reusing the slot if it is stale.
+// It returns the stale slot it replaced, which is empty if there was none.
+func (w *slidingWindow) Observe(now time.Time, obs requestObservation) (replaced windowSlot) {
+	index := w.slotIndex(now)
+	slot := &w.slots[index%int64(len(w.slots))]
+	if slot.index != index {
+		replaced = *slot
+		*slot = windowSlot{index: index}
+	}
+
+	slot.requests++
+	if obs.status >= 400 {
+		slot.errors++
+	}
+	if obs.status >= 500 {
+		slot.serverErrors++
+	}
+	satisfied, tolerating := apdexZone(obs.duration, obs.status, obs.apdexThreshold)
+	if satisfied {
+		slot.satisfied++
+	} else if tolerating {
+		slot.tolerating++
+	}
+	slot.responseBytes += obs.responseSize
+	slot.totalDuration += obs.duration
+	if obs.detailed {
+		slot.timedDuration += obs.duration
+		slot.totalOverhead += obs.overhead
+		if obs.status < 400 {
+			slot.detailedSuccesses++
+			if obs.retryAttempts > 0 {
+				slot.retriedSuccesses++
+			}
+		}
+	}
+	if obs.duration > slot.maxDuration {
+		slot.maxDuration = obs.duration
+	}
+	if w.rolledUp {
+		return replaced
+	}
+	if slot.sketch == nil {
+		slot.sketch = newDDSketch()
+	}
+	slot.sketch.Add(obs.duration)
+	return replaced
+}
+
+// merge adds the current slots of other, which must have the same layout. It
+// returns the slots left out, those of other older than the slot w holds in
+// their place and those of w replaced by newer slots of other.
+func (w *slidingWindow) merge(other *slidingWindow) (leftOut []windowSlot) {
+	for i := range other.slots {
+		src, dst := &other.slots[i], &w.slots[i]
+		if src.requests == 0 {
+			continue
+		}
+		if dst.index != src.index {
+			if dst.index > src.index {
+				leftOut = append(leftOut, *src)
+				continue
+			}
+			if dst.requests > 0 {
+				leftOut = append(leftOut, *dst)
+			}
+			*dst = windowSlot{index: src.index}
+		}
+		dst.requests += src.requests
+		dst.errors += src.errors
+		dst.serverErrors += src.serverErrors
+		dst.satisfied += src.satisfied
+		dst.tolerating += src.tolerating
+		dst.responseBytes += src.responseBytes
+		dst.totalDuration += src.totalDuration
+		dst.timedDuration += src.timedDuration
+		dst.totalOverhead += src.totalOverhead
+		dst.detailedSuccesses += src.detailedSuccesses
+		dst.retriedSuccesses += src.retriedSuccesses
+		if src.maxDuration > dst.maxDuration {
+			dst.maxDuration = src.maxDuration
+		}
+		if dst.sketch == nil {
+			dst.sketch = newDDSketch()
+		}
+		dst.sketch.Merge(src.sketch)
+	}
+	return leftOut
+}
+
+// Summary aggregates the slots that are still inside the window at now. The
+// current slot has only partly elapsed, so the slots cover between one slot
+// less than the window's length and its full length.
+func (w *slidingWindow) Summary(now time.Time) windowSummary {
+	current := w.slotIndex(now)
+	elapsed := time.Duration(now.UnixNano() - current*int64(w.slotSize))
+	summary := windowSummary{Span: time.Duration(len(w.slots)-1)*w.slotSize + elapsed, sketch: newDDSketch()}
+	for i := range w.slots {
+		slot := &w.slots[i]
+		if slot.requests == 0 || current-slot.index >= int64(len(w.slots)) {
+			continue
+		}
+		summary.Requests += slot.requests
+		summary.Errors += slot.errors
+		summary.ServerErrors += slot.serverErrors
+		summary.Satisfied += slot.satisfied
+		summary.Tolerating += slot.tolerating
+		summary.ResponseBytes += slot.responseBytes
+		summary.TotalDuration += slot.totalDuration
+		summary.TimedDuration += slot.timedDuration
+		summary.TotalOverhead += slot.totalOverhead
+		summary.DetailedSuccesses += slot.detailedSuccesses
+		summary.RetriedSuccesses += slot.retriedSuccesses
+		if slot.maxDuration > summary.MaxDuration {
+			summary.MaxDuration = slot.maxDuration
+		}
+		summary.sketch.Merge(slot.sketch)
+	}
+	return summary
+}
+
+// windowSet holds sliding windows of different lengths over the same requests.
+// Every window counts each request, but only the shortest one sketches its
+// latency. A slot of the shortest window is rolled up into the longer windows
+// when it is reused, and summaries of a longer window merge in the slots not
+// rolled up yet, so a request costs one sketch update however many windows
+// there are.
+type windowSet struct {
+	windows []*slidingWindow // shortest first
+}
+
+// newWindowSet creates a window of windowSlots slots for each distinct length
+func newWindowSet(lengths ...time.Duration) *windowSet {
+	sort.Slice(lengths, func(i, j int) bool { return lengths[i] < lengths[j] })
+	ws := &windowSet{}
+	for _, length := range lengths {
+		if n := len(ws.windows); n > 0 && ws.windows[n-1].length() == length {
+			continue
+		}
+		w := newSlidingWindow(length, windowSlots)
+		w.rolledUp = len(ws.windows) > 0
+		ws.windows = append(ws.windows, w)
+	}
+	return ws
+}
+
+func (ws *windowSet) window(length time.Duration) *slidingWindow {
+	for _, w := range ws.windows {
+		if w.length() == length {
+			return w
+		}
+	}
+	return nil
+}
+
+// Observe adds a request to every window
+func (ws *windowSet) Observe(now time.Time, obs requestObservation) {
+	for i, w := range ws.windows {
+		replaced := w.Observe(now, obs)
+		if i == 0 {
+			ws.rollUp(replaced, w.slotSize)
+		}
+	}
+}
+
+// rollUp merges the sketch of a slot of slotSize into the slots of the longer
+// windows that cover its start, unless they were reused since
+func (ws *windowSet) rollUp(slot windowSlot, slotSize time.Duration) {
+	if slot.sketch == nil {
+		return
+	}
+	start := slot.index * int64(slotSize)
+	for _, w := range ws.windows[1:] {
+		if w.slotSize <= slotSize {
+			continue
+		}
+		index := start / int64(w.slotSize)
+		target := &w.slots[index%int64(len(w.slots))]
+		if target.index != index {
+			continue
+		}
+		if target.sketch == nil {
+			target.sketch = newDDSketch()
+		}
+		target.sketch.Merge(slot.sketch)
+	}
+}
+
+// Summary aggregates the window of the given length at now, if the set has one
+func (ws *windowSet) Summary(length time.Duration, now time.Time) (windowSummary, bool) {
+	w := ws.window(length)
+	if w == nil {
+		return windowSummary{}, false
+	}
+	summary := w.Summary(now)
+	if shortest := ws.windows[0]; w != shortest {
+		current := w.slotIndex(now)
+		for i := range shortest.slots {
+			slot := &shortest.slots[i]
+			if slot.sketch == nil || current-slot.index*int64(shortest.slotSize)/int64(w.slotSize) >= int64(len(w.slots)) {
+				continue
+			}
+			summary.sketch.Merge(slot.sketch)
+		}
+	}
+	return summary, true
+}
+
+// merge adds the windows of other to the windows of the same length. Windows
+// only one of the sets has are left as they are.
+func (ws *windowSet) merge(other *windowSet) {
+	shortest := other.windows[0]
+	for _, o := range other.windows {
+		w := ws.window(o.length())
+		if w == nil {
+			continue
+		}
+		leftOut := w.merge(o)
+		if w != ws.windows[0] {
+			continue
+		}
+		// The slots of the shortest window left out may still be in the longer ones
+		for _, slot := range leftOut {
+			ws.rollUp(slot, w.slotSize)
+		}
+		if o == shortest {
+			// The sketches other has not rolled up yet are now waiting in ws
+			shortest = nil
+		}
+	}
+	if shortest != nil {
+		for _, slot := range shortest.slots {
+			ws.rollUp(slot, shortest.slotSize)
+		}
+	}
+}
+
+// windowSummary is the aggregate of a sliding window
+type windowSummary struct {
+	Requests          int64
+	Errors            int64
+	ServerErrors      int64
+	Satisfied         int64
+	Tolerating        int64
+	ResponseBytes     int64
+	TotalDuration     float64
+	MaxDuration       float64
+	TimedDuration     float64
+	TotalOverhead     float64
+	DetailedSuccesses int64
+	RetriedSuccesses  int64
+	Span              time.Duration // time the summarized slots cover
+	sketch            *ddSketch
+}
+
+// RequestRate is the requests per second over the time the window covers
+func (s windowSummary) RequestRate() float64 {
+	if s.Span <= 0 {
+		return 0
+	}
+	return float64(s.Requests) / s.Span.Seconds()
+}
+
+func (s windowSummary) AvgLatency() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return s.TotalDuration / float64(s.Requests)
+}
+
+// Throughput is the response bytes per second spent serving the requests
+func (s windowSummary) Throughput() float64 {
+	if s.TotalDuration <= 0 {
+		return 0
+	}
+	return float64(s.ResponseBytes) / s.TotalDuration
+}
+
+func (s windowSummary) ErrorRate() float64 {
+	return s.ratio(s.Errors)
+}
+
+func (s windowSummary) ClientErrorRate() float64 {
+	return s.ratio(s.Errors - s.ServerErrors)
+}
+
+func (s windowSummary) ServerErrorRate() float64 {
+	return s.ratio(s.ServerErrors)
+}
+
+func (s windowSummary) ratio(count int64) float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(count) / float64(s.Requests)
+}
+
+// Quantile estimates the q-quantile latency from the window's sketch
+func (s windowSummary) Quantile(q float64) float64 {
+	return s.sketch.Quantile(q)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlidingWindowSummary(t *testing.T) {
+	// Twelve one second slots
+	start := time.Unix(1700000000, 0)
+	at := func(offset time.Duration) time.Time { return start.Add(offset) }
+
+	tests := []struct {
+		name         string
+		observations []time.Duration // offsets of 100ms requests from start
+		now          time.Duration
+		wantRequests int64
+		wantSpan     time.Duration
+	}{
+		{name: "empty", now: 0, wantSpan: 11 * time.Second},
+		{name: "current slot", observations: []time.Duration{0, 200 * time.Millisecond}, now: 500 * time.Millisecond, wantRequests: 2, wantSpan: 11500 * time.Millisecond},
+		{name: "whole window", observations: []time.Duration{0, 5 * time.Second, 11 * time.Second}, now: 11 * time.Second, wantRequests: 3, wantSpan: 11 * time.Second},
+		{name: "oldest slot ages out", observations: []time.Duration{0, 5 * time.Second, 11 * time.Second}, now: 12 * time.Second, wantRequests: 2, wantSpan: 11 * time.Second},
+		{name: "stale slot is reused", observations: []time.Duration{0, 0, 12 * time.Second}, now: 12 * time.Second, wantRequests: 1, wantSpan: 11 * time.Second},
+		{name: "everything aged out", observations: []time.Duration{0, 3 * time.Second}, now: time.Minute, wantSpan: 11 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newSlidingWindow(12*time.Second, 12)
+			for _, offset := range tt.observations {
+				w.Observe(at(offset), requestObservation{duration: 0.1, status: 200})
+			}
+			summary := w.Summary(at(tt.now))
+			if summary.Requests != tt.wantRequests || summary.Span != tt.wantSpan {
+				t.Errorf("Summary = %d requests over %s, want %d over %s", summary.Requests, summary.Span, tt.wantRequests, tt.wantSpan)
+			}
+			if summary.sketch.Count != tt.wantRequests {
+				t.Errorf("sketch holds %d latencies, want %d", summary.sketch.Count, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestSlidingWindowRequestRate(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	w := newSlidingWindow(time.Minute, 12)
+	for i := 0; i < 120; i++ {
+		w.Observe(start.Add(time.Duration(i)*500*time.Millisecond), requestObservation{duration: 0.01, status: 200})
+	}
+	// Two requests per second for a minute, read just after a slot started
+	summary := w.Summary(start.Add(time.Minute))
+	if got := summary.RequestRate(); got < 1.99 || got > 2.01 {
+		t.Errorf("RequestRate = %v over %s, want 2", got, summary.Span)
+	}
+}
+
+func TestSlidingWindowMerge(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	observe := func(w *slidingWindow, offset time.Duration, status int, duration float64) {
+		w.Observe(start.Add(offset), requestObservation{duration: duration, status: status})
+	}
+
+	dst := newSlidingWindow(12*time.Second, 12)
+	observe(dst, 0, 200, 0.1)
+	observe(dst, 5*time.Second, 200, 0.1)
+	src := newSlidingWindow(12*time.Second, 12)
+	observe(src, 5*time.Second, 500, 0.4)  // same slot as dst
+	observe(src, 13*time.Second, 200, 0.2) // newer than the slot dst holds at that position
+	observe(src, 8*time.Second, 404, 0.3)  // a slot dst has not used
+
+	dst.merge(src)
+	summary := dst.Summary(start.Add(13 * time.Second))
+	if summary.Requests != 4 || summary.Errors != 2 || summary.ServerErrors != 1 {
+		t.Errorf("merged = %d requests, %d errors, %d server errors, want 4, 2, 1", summary.Requests, summary.Errors, summary.ServerErrors)
+	}
+	if summary.MaxDuration != 0.4 || summary.sketch.Count != 4 {
+		t.Errorf("merged max %v over %d latencies, want 0.4 over 4", summary.MaxDuration, summary.sketch.Count)
+	}
+
+	// Slots older than those dst holds are not merged
+	old := newSlidingWindow(12*time.Second, 12)
+	observe(old, 1*time.Second, 200, 0.1) // the position dst reused for 13s
+	dst.merge(old)
+	if got := dst.Summary(start.Add(13 * time.Second)).Requests; got != 4 {
+		t.Errorf("requests after merging a stale slot = %d, want 4", got)
+	}
+}
+
+func TestWindowSetSummary(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name         string
+		observations []time.Duration
+		now          time.Duration
+		length       time.Duration
+		wantRequests int64
+	}{
+		{name: "shortest window", observations: everySecond(30), now: 29 * time.Second, length: 12 * time.Second, wantRequests: 12},
+		{name: "rolled up slots", observations: everySecond(30), now: 29 * time.Second, length: time.Minute, wantRequests: 30},
+		{name: "slots not rolled up yet", observations: []time.Duration{0, 20 * time.Second}, now: 20 * time.Second, length: time.Minute, wantRequests: 2},
+		{name: "rolled up slots age out", observations: everySecond(90), now: 89 * time.Second, length: time.Minute, wantRequests: 60},
+		{name: "stale slots age out", observations: []time.Duration{0, 20 * time.Second}, now: 61 * time.Second, length: time.Minute, wantRequests: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := newWindowSet(time.Minute, 12*time.Second, time.Minute)
+			if len(ws.windows) != 2 {
+				t.Fatalf("windows = %d, want 2", len(ws.windows))
+			}
+			for _, offset := range tt.observations {
+				ws.Observe(start.Add(offset), requestObservation{duration: 0.1, status: 200})
+			}
+			summary, exists := ws.Summary(tt.length, start.Add(tt.now))
+			if !exists {
+				t.Fatalf("no %s window", tt.length)
+			}
+			if summary.Requests != tt.wantRequests || summary.sketch.Count != tt.wantRequests {
+				t.Errorf("Summary = %d requests with %d latencies, want %d", summary.Requests, summary.sketch.Count, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestWindowSetMerge(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	dst := newWindowSet(12*time.Second, time.Minute)
+	src := newWindowSet(12*time.Second, time.Minute)
+	for _, offset := range everySecond(30) {
+		dst.Observe(start.Add(offset), requestObservation{duration: 0.1, status: 200})
+		// src is five seconds ahead, so some of its slots replace those of dst
+		src.Observe(start.Add(offset+5*time.Second), requestObservation{duration: 0.2, status: 500})
+	}
+
+	dst.merge(src)
+	now := start.Add(34 * time.Second)
+	for _, length := range []time.Duration{12 * time.Second, time.Minute} {
+		want, _ := src.Summary(length, now)
+		own := newWindowSet(12*time.Second, time.Minute)
+		for _, offset := range everySecond(30) {
+			own.Observe(start.Add(offset), requestObservation{duration: 0.1, status: 200})
+		}
+		mine, _ := own.Summary(length, now)
+		got, _ := dst.Summary(length, now)
+		if got.Requests != want.Requests+mine.Requests || got.sketch.Count != got.Requests || got.ServerErrors != want.ServerErrors {
+			t.Errorf("%s window = %d requests with %d latencies and %d server errors, want %d, %d and %d",
+				length, got.Requests, got.sketch.Count, got.ServerErrors, want.Requests+mine.Requests, want.Requests+mine.Requests, want.ServerErrors)
+		}
+	}
+}
+
+// everySecond is one request a second from the start on
+func everySecond(n int) []time.Duration {
+	offsets := make([]time.Duration, n)
+	for i := range offsets {
+		offsets[i] = time.Duration(i) * time.Second
+	}
+	return offsets
+}
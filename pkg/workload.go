@@ -0,0 +1,339 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logger "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+)
+
+const (
+	// workloadCacheTTL is how long a router's resolved workload is reused
+	workloadCacheTTL = 30 * time.Second
+	// workloadOverflowValue replaces label values beyond the cardinality budget
+	workloadOverflowValue = "__other__"
+	// defaultMaxWorkloadLabelValues is the default cardinality budget per label
+	defaultMaxWorkloadLabelValues = 50
+)
+
+var (
+	invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+	// workloads is nil unless workload metadata is enabled
+	workloads *WorkloadResolver
+)
+
+// WorkloadMetadataConfig selects the Kubernetes metadata copied onto workload metrics
+type WorkloadMetadataConfig struct {
+	PodLabels            []string `json:"PodLabels"`
+	PodAnnotations       []string `json:"PodAnnotations"`
+	NamespaceLabels      []string `json:"NamespaceLabels"`
+	NamespaceAnnotations []string `json:"NamespaceAnnotations"`
+	MaxValuesPerLabel    int      `json:"MaxValuesPerLabel"`
+}
+
+// metadataLabel is one allowlisted label or annotation and the metric label it becomes
+type metadataLabel struct {
+	key         string
+	metricLabel string
+	fromPod     bool
+	annotation  bool
+}
+
+// workloadInfo is the workload that serves a router
+type workloadInfo struct {
+	namespace string
+	kind      string
+	name      string
+	extra     []string // values of the allowlisted labels, in metadataLabel order
+	resolved  time.Time
+}
+
+// WorkloadResolver maps routers to the Deployment or StatefulSet behind them,
+// via the IngressRoute or Ingress backends, the Service selector and the pods'
+// owners, and exports request metrics labelled with the workload metadata
+type WorkloadResolver struct {
+	services    corev1listers.ServiceLister
+	pods        corev1listers.PodLister
+	replicaSets appsv1listers.ReplicaSetLister
+	namespaces  corev1listers.NamespaceLister
+
+	metadata []metadataLabel
+	budget   int
+
+	mu     sync.Mutex
+	cache  map[string]*workloadInfo        // keyed by router name
+	values map[string]map[string]time.Time // distinct values per metric label and when they were last seen
+
+	info     *prometheus.GaugeVec
+	requests *prometheus.CounterVec
+	duration *histogramSet
+	overflow *prometheus.CounterVec
+}
+
+// NewWorkloadResolver registers the informers it needs and the workload metrics,
+// whose label names depend on the configured allowlist
+func NewWorkloadResolver(ki *KubernetesInformers, config WorkloadMetadataConfig) *WorkloadResolver {
+	wr := newWorkloadResolver(ki, config)
+	prometheus.MustRegister(wr.info, wr.requests, wr.duration, wr.overflow)
+	return wr
+}
+
+// newWorkloadResolver creates the resolver and its metrics without registering them
+func newWorkloadResolver(ki *KubernetesInformers, config WorkloadMetadataConfig) *WorkloadResolver {
+	wr := &WorkloadResolver{
+		services:    ki.Factory.Core().V1().Services().Lister(),
+		pods:        ki.Factory.Core().V1().Pods().Lister(),
+		replicaSets: ki.Factory.Apps().V1().ReplicaSets().Lister(),
+		budget:      config.MaxValuesPerLabel,
+		cache:       make(map[string]*workloadInfo),
+		values:      make(map[string]map[string]time.Time),
+	}
+	if wr.budget <= 0 {
+		wr.budget = defaultMaxWorkloadLabelValues
+	}
+
+	add := func(keys []string, prefix string, fromPod, annotation bool) {
+		for _, key := range keys {
+			wr.metadata = append(wr.metadata, metadataLabel{
+				key:         key,
+				metricLabel: prefix + invalidLabelChars.ReplaceAllString(key, "_"),
+				fromPod:     fromPod,
+				annotation:  annotation,
+			})
+		}
+	}
+	add(config.PodLabels, "label_", true, false)
+	add(config.PodAnnotations, "annotation_", true, true)
+	add(config.NamespaceLabels, "namespace_label_", false, false)
+	add(config.NamespaceAnnotations, "namespace_annotation_", false, true)
+	if len(config.NamespaceLabels)+len(config.NamespaceAnnotations) > 0 {
+		wr.namespaces = ki.Factory.Core().V1().Namespaces().Lister()
+	}
+
+	workloadLabels := []string{"app", "namespace", "workload_kind", "workload"}
+	for _, m := range wr.metadata {
+		workloadLabels = append(workloadLabels, m.metricLabel)
+	}
+
+	wr.info = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "traefik_officer_workload_info",
+		Help: "Workload serving each app, with the allowlisted pod and namespace metadata",
+	}, workloadLabels)
+	wr.requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "traefik_officer_workload_requests_total",
+		Help: "Total number of HTTP requests per workload",
+	}, append(append([]string{}, workloadLabels...), "response_code"))
+	wr.duration = newHistogramSet(prometheus.HistogramOpts{
+		Name: "traefik_officer_workload_request_duration_seconds",
+		Help: "Duration of HTTP requests per workload in seconds",
+	}, workloadLabels)
+	wr.overflow = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "traefik_officer_workload_label_overflow_total",
+		Help: "Requests whose workload label value was replaced because the label's cardinality budget was used up",
+	}, []string{"label"})
+
+	return wr
+}
+
+// Observe records a request against the workload serving the router
+func (wr *WorkloadResolver) Observe(router RouterInfo, code string, duration float64) {
+	if wr == nil {
+		return
+	}
+
+	workload := wr.resolve(router)
+	if workload == nil {
+		return
+	}
+
+	config := CurrentConfig()
+	service := router.ServiceKey()
+	lvs := wr.labelValues(service, workload, config.SeriesIdleTTL())
+	requestLvs := append(append([]string{}, lvs...), code)
+	wr.info.WithLabelValues(lvs...).Set(1)
+	wr.requests.WithLabelValues(requestLvs...).Inc()
+	wr.duration.WithLabelValues(config.LatencyHistogramFor(service, ""), lvs...).Observe(duration)
+	series.Touch("workload_info", wr.info, lvs...)
+	series.Touch("workload_requests_total", wr.requests, requestLvs...)
+	series.Touch("workload_request_duration_seconds", wr.duration, lvs...)
+}
+
+// labelValues applies the cardinality budget to the workload's label values
+func (wr *WorkloadResolver) labelValues(app string, workload *workloadInfo, idleTTL time.Duration) []string {
+	now := time.Now()
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	lvs := []string{app, workload.namespace, workload.kind,
+		wr.withinBudget("workload", workload.namespace+"/"+workload.name, workload.name, now, idleTTL)}
+	for i, m := range wr.metadata {
+		lvs = append(lvs, wr.withinBudget(m.metricLabel, workload.extra[i], workload.extra[i], now, idleTTL))
+	}
+	return lvs
+}
+
+// withinBudget returns value, or the overflow value once the label has used up
+// its budget of distinct keys. Keys idle for longer than the series TTL give
+// their place to new ones, so values that changed over rollouts do not use up
+// the budget. The caller must hold mu.
+func (wr *WorkloadResolver) withinBudget(label, key, value string, now time.Time, idleTTL time.Duration) string {
+	seen, exists := wr.values[label]
+	if !exists {
+		seen = make(map[string]time.Time)
+		wr.values[label] = seen
+	}
+	if _, known := seen[key]; !known && len(seen) >= wr.budget {
+		if idleTTL > 0 {
+			for k, lastSeen := range seen {
+				if now.Sub(lastSeen) > idleTTL {
+					delete(seen, k)
+				}
+			}
+		}
+		if len(seen) >= wr.budget {
+			wr.overflow.WithLabelValues(label).Inc()
+			series.Touch("workload_label_overflow_total", wr.overflow, label)
+			return workloadOverflowValue
+		}
+	}
+	seen[key] = now
+	return value
+}
+
+// resolve returns the cached workload of the router, refreshing it when stale
+func (wr *WorkloadResolver) resolve(router RouterInfo) *workloadInfo {
+	wr.mu.Lock()
+	cached, exists := wr.cache[router.Name]
+	wr.mu.Unlock()
+	if exists && time.Since(cached.resolved) < workloadCacheTTL {
+		if cached.kind == "" {
+			return nil
+		}
+		return cached
+	}
+
+	workload := wr.lookup(router)
+	workload.resolved = time.Now()
+
+	wr.mu.Lock()
+	wr.cache[router.Name] = workload
+	wr.mu.Unlock()
+
+	if workload.kind == "" {
+		return nil
+	}
+	return workload
+}
+
+// lookup walks router -> backend Service -> selected pods -> owning workload.
+// An empty kind in the result means the router could not be resolved.
+func (wr *WorkloadResolver) lookup(router RouterInfo) *workloadInfo {
+	svc, found := discoveredServices.Lookup(router)
+	if !found {
+		logger.Debugf("No IngressRoute or Ingress found for router %s", router.Name)
+		return &workloadInfo{}
+	}
+
+	// Count pods per owning workload across all backends and keep the largest.
+	// Pod metadata comes from the newest pod, so it follows a rollout instead of
+	// flipping between the old and new values.
+	type owner struct{ namespace, kind, name string }
+	counts := make(map[owner]int)
+	newestPods := make(map[owner]*v1.Pod)
+	for _, backend := range svc.Backends {
+		namespace, name, _ := strings.Cut(backend, "/")
+		service, err := wr.services.Services(namespace).Get(name)
+		if err != nil || len(service.Spec.Selector) == 0 {
+			continue
+		}
+		pods, err := wr.pods.Pods(namespace).List(labels.SelectorFromSet(service.Spec.Selector))
+		if err != nil {
+			continue
+		}
+		for _, pod := range pods {
+			kind, workloadName := wr.podOwner(pod)
+			o := owner{namespace, kind, workloadName}
+			counts[o]++
+			if newest, exists := newestPods[o]; !exists || newerPod(pod, newest) {
+				newestPods[o] = pod
+			}
+		}
+	}
+	if len(counts) == 0 {
+		logger.Debugf("No pods found behind router %s", router.Name)
+		return &workloadInfo{}
+	}
+
+	owners := make([]owner, 0, len(counts))
+	for o := range counts {
+		owners = append(owners, o)
+	}
+	sort.Slice(owners, func(i, j int) bool {
+		if counts[owners[i]] != counts[owners[j]] {
+			return counts[owners[i]] > counts[owners[j]]
+		}
+		return owners[i].kind+owners[i].name < owners[j].kind+owners[j].name
+	})
+	best := owners[0]
+
+	workload := &workloadInfo{namespace: best.namespace, kind: best.kind, name: best.name}
+	var nsLabels, nsAnnotations map[string]string
+	if wr.namespaces != nil {
+		if ns, err := wr.namespaces.Get(best.namespace); err == nil {
+			nsLabels, nsAnnotations = ns.Labels, ns.Annotations
+		}
+	}
+	for _, m := range wr.metadata {
+		source := nsLabels
+		switch {
+		case m.fromPod && m.annotation:
+			source = newestPods[best].Annotations
+		case m.fromPod:
+			source = newestPods[best].Labels
+		case m.annotation:
+			source = nsAnnotations
+		}
+		workload.extra = append(workload.extra, source[m.key])
+	}
+	return workload
+}
+
+// newerPod reports whether pod was created after other, breaking ties by name
+func newerPod(pod, other *v1.Pod) bool {
+	if !pod.CreationTimestamp.Equal(&other.CreationTimestamp) {
+		return other.CreationTimestamp.Before(&pod.CreationTimestamp)
+	}
+	return pod.Name > other.Name
+}
+
+// podOwner returns the kind and name of the workload controlling a pod,
+// following ReplicaSets up to their Deployment
+func (wr *WorkloadResolver) podOwner(pod *v1.Pod) (string, string) {
+	for _, ref := range pod.OwnerReferences {
+		if ref.Controller == nil || !*ref.Controller {
+			continue
+		}
+		if ref.Kind == "ReplicaSet" {
+			rs, err := wr.replicaSets.ReplicaSets(pod.Namespace).Get(ref.Name)
+			if err == nil {
+				for _, rsRef := range rs.OwnerReferences {
+					if rsRef.Controller != nil && *rsRef.Controller {
+						return rsRef.Kind, rsRef.Name
+					}
+				}
+			}
+		}
+		return ref.Kind, ref.Name
+	}
+	return "Pod", pod.Name
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// startFakeWorkloadResolver serves the objects through fake informers
+func startFakeWorkloadResolver(t *testing.T, config WorkloadMetadataConfig, objects ...runtime.Object) *WorkloadResolver {
+	t.Helper()
+	ki := NewKubernetesInformers(fake.NewSimpleClientset(objects...), dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()), "")
+	wr := newWorkloadResolver(ki, config)
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	if err := ki.Start(stopCh); err != nil {
+		t.Fatalf("starting informers: %v", err)
+	}
+	return wr
+}
+
+func controllerRef(kind, name string) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &controller}}
+}
+
+func workloadPod(name, app, version string, created time.Time, owners []metav1.OwnerReference) *v1.Pod {
+	return &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Namespace:         "shop",
+		Name:              name,
+		Labels:            map[string]string{"app": app, "app.kubernetes.io/version": version},
+		CreationTimestamp: metav1.NewTime(created),
+		OwnerReferences:   owners,
+	}}
+}
+
+func TestWorkloadResolverLookup(t *testing.T) {
+	discoveredServices = &serviceDiscovery{services: make(map[string]*DiscoveredService)}
+	routerNames = newRouterNameParser()
+
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	service := func(name, app string) *v1.Service {
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name},
+			Spec:       v1.ServiceSpec{Selector: map[string]string{"app": app}},
+		}
+	}
+	replicaSet := func(name string) *appsv1.ReplicaSet {
+		return &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name, OwnerReferences: controllerRef("Deployment", "store")}}
+	}
+	wr := startFakeWorkloadResolver(t, WorkloadMetadataConfig{PodLabels: []string{"app.kubernetes.io/version"}, NamespaceLabels: []string{"team"}},
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop", Labels: map[string]string{"team": "checkout"}}},
+		service("store", "store"), service("db", "db"), service("debug", "debug"), service("empty", "nothing"),
+		replicaSet("store-v1"), replicaSet("store-v2"),
+		// A rollout in progress: the newest pod has the new version
+		workloadPod("store-v1-a", "store", "1.0", created, controllerRef("ReplicaSet", "store-v1")),
+		workloadPod("store-v2-a", "store", "2.0", created.Add(time.Hour), controllerRef("ReplicaSet", "store-v2")),
+		workloadPod("store-v1-b", "store", "1.0", created, controllerRef("ReplicaSet", "store-v1")),
+		workloadPod("db-0", "db", "15", created, controllerRef("StatefulSet", "db")),
+		workloadPod("debug", "debug", "dev", created, nil),
+	)
+
+	for _, name := range []string{"store", "db", "debug", "empty"} {
+		discoveredServices.upsert(&DiscoveredService{
+			Kind:      kindIngressRoute,
+			Namespace: "shop",
+			Name:      name,
+			Routers:   []string{"shop-" + name + "-1234@kubernetescrd"},
+			Backends:  []string{"shop/" + name},
+		})
+	}
+
+	tests := []struct {
+		resource  string
+		wantKind  string
+		wantName  string
+		wantExtra []string
+	}{
+		{resource: "store", wantKind: "Deployment", wantName: "store", wantExtra: []string{"2.0", "checkout"}},
+		{resource: "db", wantKind: "StatefulSet", wantName: "db", wantExtra: []string{"15", "checkout"}},
+		{resource: "debug", wantKind: "Pod", wantName: "debug", wantExtra: []string{"dev", "checkout"}},
+		{resource: "empty"},
+		{resource: "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.resource, func(t *testing.T) {
+			router := RouterInfo{Name: "shop-" + tt.resource + "-1234@kubernetescrd", Provider: providerKubernetesCRD, Namespace: "shop", Resource: tt.resource}
+			got := wr.lookup(router)
+			if got.kind != tt.wantKind || got.name != tt.wantName {
+				t.Fatalf("lookup = %s/%s, want %s/%s", got.kind, got.name, tt.wantKind, tt.wantName)
+			}
+			if tt.wantKind == "" {
+				return
+			}
+			if got.namespace != "shop" || len(got.extra) != len(tt.wantExtra) {
+				t.Fatalf("lookup = %+v, want namespace shop and extra %v", got, tt.wantExtra)
+			}
+			for i := range tt.wantExtra {
+				if got.extra[i] != tt.wantExtra[i] {
+					t.Errorf("extra = %v, want %v", got.extra, tt.wantExtra)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestWorkloadResolverBudget(t *testing.T) {
+	wr := startFakeWorkloadResolver(t, WorkloadMetadataConfig{MaxValuesPerLabel: 2})
+	now := time.Now()
+	ttl := time.Hour
+
+	tests := []struct {
+		name string
+		key  string
+		at   time.Time
+		want string
+	}{
+		{name: "first value", key: "a", at: now, want: "a"},
+		{name: "second value", key: "b", at: now.Add(30 * time.Minute), want: "b"},
+		{name: "known value within budget", key: "a", at: now.Add(30 * time.Minute), want: "a"},
+		{name: "budget used up", key: "c", at: now.Add(45 * time.Minute), want: workloadOverflowValue},
+		{name: "idle values make room", key: "c", at: now.Add(100 * time.Minute), want: "c"},
+		{name: "room left after eviction", key: "d", at: now.Add(101 * time.Minute), want: "d"},
+		{name: "budget used up again", key: "e", at: now.Add(102 * time.Minute), want: workloadOverflowValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wr.mu.Lock()
+			got := wr.withinBudget("label_test", tt.key, tt.key, tt.at, ttl)
+			wr.mu.Unlock()
+			if got != tt.want {
+				t.Errorf("withinBudget(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+	if got := testutil.ToFloat64(wr.overflow.WithLabelValues("label_test")); got != 2 {
+		t.Errorf("overflow count = %v, want 2", got)
+	}
+}